@@ -0,0 +1,201 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package archive is the stable API for reading jrepack archives.
+
+Archive is opened with its header, entries are iterated in the header order:
+
+	r, err := archive.Open("jre.dat", archive.Options{Limits: archive.DefaultLimits})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for it := r.Entries(); it.Next(); {
+		e := it.Entry()
+		fmt.Println(e.Path, e.Size, e.Folder, e.Container)
+	}
+
+Data of the file entry is read by Open or OpenEntry. Only the data segment of
+the entry is decoded while the data is read, and the data is checked against
+its hash summ at the end. Decoders of the segments are kept by the reader, so
+reading of the entries in the iterator order decodes each segment once, while
+reading of the entry before the already read one decodes its segment from the
+start again.
+*/
+package archive
+
+import (
+	"crypto/ed25519"
+	"io"
+	"io/fs"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/internal/pkg/unpacker"
+)
+
+var (
+	// ErrCorrupted is the error for the truncated or damaged archive
+	ErrCorrupted = common.ErrCorrupted
+
+	// ErrEncrypted is the error for the encrypted archive without password
+	ErrEncrypted = common.ErrEncrypted
+
+	// ErrPassword is the error for the wrong password of the encrypted archive
+	ErrPassword = common.ErrPassword
+)
+
+// Limits is the set of the resource limits for the untrusted archives.
+// Zero limit means no limit.
+type Limits = common.Limits
+
+// DefaultLimits is the set of limits, sufficient for any JRE
+var DefaultLimits = common.DefaultLimits
+
+// Property is the key and value of the archive metadata
+type Property = common.Property
+
+// Options is the set of the options of the archive reading
+type Options struct {
+	// Limits are checked while the header is read and while the data is decoded
+	Limits Limits
+
+	// Password is the password of the encrypted archive
+	Password string
+
+	// PublicKeys are the trusted keys of the archive signature
+	PublicKeys []ed25519.PublicKey
+
+	// RequireSignature will refuse the unsigned archives
+	RequireSignature bool
+}
+
+// Entry is the file, folder or container of the archive. Entry, which is
+// neither folder nor container, is the file. It is the same type as the
+// entry of jrepack.List.
+type Entry = unpacker.Entry
+
+// Reader is the opened archive. It is safe for the concurrent use.
+type Reader struct {
+	archive *unpacker.Archive
+	entries []Entry
+	paths   map[string]int
+}
+
+// Open will open the archive file and read its header. Signature is checked,
+// when the options have the trusted keys.
+func Open(filename string, options Options) (*Reader, error) {
+	a, err := unpacker.OpenArchive(filename, unpacker.Options{
+		Limits:           options.Limits,
+		Password:         options.Password,
+		PublicKeys:       options.PublicKeys,
+		RequireSignature: options.RequireSignature,
+	})
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{archive: a, entries: a.Entries()}
+	r.paths = make(map[string]int, len(r.entries))
+	for i, e := range r.entries {
+		r.paths[e.Path] = i
+	}
+	return r, nil
+}
+
+// Close will close the archive file
+func (r *Reader) Close() error {
+	return r.archive.Close()
+}
+
+// Metadata is the user defined properties of the archive
+func (r *Reader) Metadata() []Property {
+	return r.archive.Header.Metadata
+}
+
+// Release is the properties of the JRE release file, nil when the JRE has no release file
+func (r *Reader) Release() []Property {
+	return r.archive.Header.Release
+}
+
+// Len is the number of the entries
+func (r *Reader) Len() int {
+	return len(r.entries)
+}
+
+// Entries will return the iterator over all entries in the header order
+func (r *Reader) Entries() *Iterator {
+	return &Iterator{entries: r.entries, i: -1}
+}
+
+// Lookup will find the entry by its path
+func (r *Reader) Lookup(name string) (Entry, bool) {
+	i, ok := r.paths[name]
+	if !ok {
+		return Entry{}, false
+	}
+	return r.entries[i], true
+}
+
+// Open will open data of the file entry by its path
+func (r *Reader) Open(name string) (io.ReadCloser, error) {
+	e, ok := r.Lookup(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return r.OpenEntry(e)
+}
+
+/*
+OpenEntry will open data of the file entry. Data is decoded while it is read,
+hash summ is checked at the end of data and its mismatch is returned by Read.
+
+Data of the archive is packed into the compressed segments. Decoder of the
+segment is kept after the reading, so the entries are read fastest in the order
+of Iterator. Reading of the entry before the already read one decodes its
+segment from the start.
+*/
+func (r *Reader) OpenEntry(e Entry) (io.ReadCloser, error) {
+	if e.Folder || e.Container {
+		return nil, &fs.PathError{Op: "open", Path: e.Path, Err: fs.ErrInvalid}
+	}
+	rc, err := r.archive.OpenEntry(e)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: e.Path, Err: err}
+	}
+	return rc, nil
+}
+
+// Iterator is the iterator over the archive entries
+type Iterator struct {
+	entries []Entry
+	i       int
+}
+
+// Next will advance the iterator to the next entry, false is returned after the last entry
+func (it *Iterator) Next() bool {
+	if it.i < len(it.entries) {
+		it.i++
+	}
+	return it.i < len(it.entries)
+}
+
+// Entry is the current entry of the iterator
+func (it *Iterator) Entry() Entry {
+	return it.entries[it.i]
+}
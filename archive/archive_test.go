@@ -0,0 +1,177 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package archive
+
+import (
+	"archive/zip"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/internal/pkg/packer"
+)
+
+// packTestTree will pack the folder with the files, the jar and the empty file
+func packTestTree(T *testing.T, name string, options packer.Options) string {
+	root, _ := filepath.Abs("../test/output/" + name)
+	common.RemoveDirReq(root)
+	jre := filepath.Join(root, "jre")
+	err := os.MkdirAll(filepath.Join(jre, "lib"), 0777)
+	if err != nil {
+		T.Fatal(err)
+	}
+	files := map[string]string{
+		"bin/java":      "java launcher",
+		"lib/empty.txt": "",
+		"release":       "JAVA_VERSION=\"1.8\"\n",
+		"web/page.html": "<p>{{.}}</p>",
+	}
+	for p, body := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(jre, p)), 0777)
+		err = ioutil.WriteFile(filepath.Join(jre, p), []byte(body), 0666)
+		if err != nil {
+			T.Fatal(err)
+		}
+	}
+	f, err := os.Create(filepath.Join(jre, "lib", "rt.jar"))
+	if err != nil {
+		T.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	zw, _ := w.Create("java/lang/Object.class")
+	zw.Write([]byte("class Object"))
+	zw, _ = w.Create("bin/copy")
+	zw.Write([]byte("java launcher"))
+	w.Close()
+	f.Close()
+
+	filename := root + ".dat"
+	os.Remove(filename)
+	err = packer.PackWithOptions(jre, filename, options)
+	if err != nil {
+		T.Fatal(err)
+	}
+	return filename
+}
+
+func TestReader(T *testing.T) {
+	filename := packTestTree(T, "archivereader", packer.Options{
+		Metadata: common.Properties{{Key: "build", Value: "42"}},
+	})
+	defer func() {
+		common.RemoveDirReq(filepath.Join(filepath.Dir(filename), "archivereader"))
+		os.Remove(filename)
+	}()
+
+	r, err := Open(filename, Options{Limits: DefaultLimits})
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer r.Close()
+
+	// kinds are the folder and container flags of the entries
+	kinds := make(map[string][2]bool)
+	n := 0
+	for it := r.Entries(); it.Next(); n++ {
+		e := it.Entry()
+		kinds[e.Path] = [2]bool{e.Folder, e.Container}
+	}
+	if n != r.Len() {
+		T.Errorf("Iterated %d entries of %d", n, r.Len())
+	}
+	folder, container, file := [2]bool{true, false}, [2]bool{false, true}, [2]bool{}
+	expected := map[string][2]bool{
+		"bin":                               folder,
+		"bin/java":                          file,
+		"lib/rt.jar":                        container,
+		"lib/rt.jar/java/lang":              folder,
+		"lib/rt.jar/java/lang/Object.class": file,
+		"lib/empty.txt":                     file,
+	}
+	for p, kind := range expected {
+		if got, ok := kinds[p]; !ok || got != kind {
+			T.Errorf("Entry %s is %v, expected %v", p, got, kind)
+		}
+	}
+
+	e, ok := r.Lookup("lib/rt.jar/bin/copy")
+	if !ok || e.ContainerPath != "lib/rt.jar" || e.Size != 13 || !e.Shared || len(e.Hash) == 0 {
+		T.Errorf("Unexpected entry %+v", e)
+	}
+	if e, _ := r.Lookup("bin/java"); e.ContainerPath != "" || e.Name() != "java" {
+		T.Errorf("Unexpected entry %+v", e)
+	}
+
+	for p, body := range map[string]string{
+		"lib/rt.jar/java/lang/Object.class": "class Object",
+		"bin/java":                          "java launcher",
+		"lib/empty.txt":                     "",
+	} {
+		rc, err := r.Open(p)
+		if err != nil {
+			T.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(b) != body {
+			T.Errorf("Unexpected data of %s: %q, %v", p, b, err)
+		}
+	}
+
+	if _, err := r.Open("missing"); !errors.Is(err, fs.ErrNotExist) {
+		T.Errorf("Missing entry is opened: %v", err)
+	}
+	if _, err := r.Open("lib"); !errors.Is(err, fs.ErrInvalid) {
+		T.Errorf("Folder is opened: %v", err)
+	}
+	if len(r.Metadata()) != 1 || r.Metadata()[0].Value != "42" || len(r.Release()) != 1 {
+		T.Errorf("Unexpected metadata %v, release %v", r.Metadata(), r.Release())
+	}
+}
+
+func TestReaderEncrypted(T *testing.T) {
+	filename := packTestTree(T, "archiveencrypted", packer.Options{Password: "secret"})
+	defer func() {
+		common.RemoveDirReq(filepath.Join(filepath.Dir(filename), "archiveencrypted"))
+		os.Remove(filename)
+	}()
+
+	_, err := Open(filename, Options{})
+	if !errors.Is(err, ErrEncrypted) {
+		T.Errorf("Encrypted archive is opened without password: %v", err)
+	}
+	r, err := Open(filename, Options{Password: "secret"})
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer r.Close()
+	rc, err := r.Open("bin/java")
+	if err != nil {
+		T.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(rc)
+	if string(b) != "java launcher" {
+		T.Errorf("Unexpected data %q", b)
+	}
+}
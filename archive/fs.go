@@ -0,0 +1,346 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FSOptions is the set of the options of the archive file system
+type FSOptions struct {
+	// RebuildContainers will present containers as the zip files, rebuilt
+	// from their entries, instead of the directories
+	RebuildContainers bool
+}
+
+/*
+FS is the read-only file system of the archive entries. It implements
+fs.FS, fs.ReadDirFS, fs.ReadFileFS and fs.StatFS, so it can be used with
+fs.WalkDir, http.FS and template.ParseFS. Data of the file is decoded into
+memory, when the file is opened, since the file is seekable. Files are opened
+fastest in the order of the archive entries, opening of the file before the
+already opened one decodes its data segment from the start. Rebuilt
+containers are kept in memory until the file system is dropped.
+*/
+type FS struct {
+	r       *Reader
+	options FSOptions
+	modTime time.Time
+
+	// dirs are the directory paths with the indexes of their entries, sorted by name
+	dirs map[string][]int
+
+	mu         sync.Mutex
+	containers map[string][]byte
+}
+
+// FS will create the file system of the archive entries
+func (r *Reader) FS(options FSOptions) *FS {
+	f := &FS{
+		r:          r,
+		options:    options,
+		modTime:    r.archive.ModTime(),
+		dirs:       map[string][]int{".": nil},
+		containers: make(map[string][]byte),
+	}
+	for i, e := range r.entries {
+		if !f.visible(e) {
+			continue
+		}
+		if f.isDir(e) {
+			if _, ok := f.dirs[e.Path]; !ok {
+				f.dirs[e.Path] = nil
+			}
+		}
+		parent := path.Dir(e.Path)
+		f.dirs[parent] = append(f.dirs[parent], i)
+	}
+	for _, children := range f.dirs {
+		sort.Slice(children, func(i, j int) bool {
+			return r.entries[children[i]].Name() < r.entries[children[j]].Name()
+		})
+	}
+	return f
+}
+
+// visible will check, that the entry is not hidden inside of the rebuilt container
+func (f *FS) visible(e Entry) bool {
+	return !f.options.RebuildContainers || e.ContainerPath == ""
+}
+
+func (f *FS) isDir(e Entry) bool {
+	return e.Folder || (e.Container && !f.options.RebuildContainers)
+}
+
+// lookup will find the visible entry, nil entry is the root directory
+func (f *FS) lookup(op, name string) (*Entry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return nil, nil
+	}
+	i, ok := f.r.paths[name]
+	if !ok || !f.visible(f.r.entries[i]) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return &f.r.entries[i], nil
+}
+
+// Open will open the file or directory of the archive
+func (f *FS) Open(name string) (fs.File, error) {
+	e, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil || f.isDir(*e) {
+		return &dir{fs: f, info: f.info(e, 0), path: name}, nil
+	}
+	b, err := f.readFile(e)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{Reader: bytes.NewReader(b), info: f.info(e, int64(len(b)))}, nil
+}
+
+// ReadFile will read the whole file of the archive
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	e, err := f.lookup("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil || f.isDir(*e) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	b, err := f.readFile(e)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// ReadDir will return entries of the directory, sorted by name
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil && !f.isDir(*e) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return f.dirEntries(name), nil
+}
+
+// Stat will return information of the file or directory
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	e, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil && e.Container && f.options.RebuildContainers {
+		b, err := f.readFile(e)
+		if err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+		}
+		return f.info(e, int64(len(b))), nil
+	}
+	return f.info(e, 0), nil
+}
+
+func (f *FS) dirEntries(name string) []fs.DirEntry {
+	children := f.dirs[name]
+	list := make([]fs.DirEntry, len(children))
+	for i, c := range children {
+		list[i] = &dirEntry{fs: f, entry: &f.r.entries[c]}
+	}
+	return list
+}
+
+// info will create information of the entry, size is used for the rebuilt containers
+func (f *FS) info(e *Entry, size int64) *fileInfo {
+	if e == nil {
+		return &fileInfo{name: ".", mode: fs.ModeDir | 0555, modTime: f.modTime}
+	}
+	info := &fileInfo{name: e.Name(), size: int64(e.Size), mode: 0444, modTime: f.modTime}
+	switch {
+	case f.isDir(*e):
+		info.size = 0
+		info.mode = fs.ModeDir | 0555
+	case e.Container:
+		info.size = size
+	}
+	return info
+}
+
+// readFile will decode data of the file or rebuild the container
+func (f *FS) readFile(e *Entry) ([]byte, error) {
+	if !e.Container {
+		rc, err := f.r.archive.OpenEntry(*e)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if b, ok := f.containers[e.Path]; ok {
+		return b, nil
+	}
+	b, err := f.rebuild(e)
+	if err != nil {
+		return nil, err
+	}
+	f.containers[e.Path] = b
+	return b, nil
+}
+
+// rebuild will write entries of the container into the new zip file in the
+// header order. Nested containers are written as the directories, like the
+// unpacker does.
+func (f *FS) rebuild(container *Entry) ([]byte, error) {
+	prefix := container.Path + "/"
+	children := make([]Entry, 0)
+	for _, e := range f.r.entries {
+		if strings.HasPrefix(e.Path, prefix) {
+			children = append(children, e)
+		}
+	}
+	files, err := f.r.archive.ReadFiles(children)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for i, e := range children {
+		isFile := !e.Folder && !e.Container
+		fh := &zip.FileHeader{Name: strings.TrimPrefix(e.Path, prefix)}
+		fh.SetModTime(f.modTime)
+		fh.SetMode(0666)
+		if !isFile {
+			fh.Name += "/"
+		} else {
+			fh.Method = zip.Deflate
+		}
+		zw, err := w.CreateHeader(fh)
+		if err == nil && isFile {
+			_, err = zw.Write(files[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fileInfo is the fs.FileInfo of the archive entry
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *fileInfo) Sys() interface{}   { return nil }
+
+// dirEntry is the fs.DirEntry of the archive entry
+type dirEntry struct {
+	fs    *FS
+	entry *Entry
+}
+
+func (d *dirEntry) Name() string { return d.entry.Name() }
+func (d *dirEntry) IsDir() bool  { return d.fs.isDir(*d.entry) }
+
+func (d *dirEntry) Type() fs.FileMode {
+	if d.IsDir() {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+func (d *dirEntry) Info() (fs.FileInfo, error) {
+	return d.fs.Stat(d.entry.Path)
+}
+
+// file is the opened file, its data is already decoded
+type file struct {
+	*bytes.Reader
+	info *fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+// dir is the opened directory
+type dir struct {
+	fs      *FS
+	info    *fileInfo
+	path    string
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: fs.ErrInvalid}
+}
+
+// ReadDir will return the next n entries of the directory, or all remaining entries for n <= 0
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		d.entries = d.fs.dirEntries(d.path)
+	}
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
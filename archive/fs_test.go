@@ -0,0 +1,138 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"html/template"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/internal/pkg/packer"
+)
+
+func TestFS(T *testing.T) {
+	filename := packTestTree(T, "archivefs", packer.Options{})
+	defer func() {
+		common.RemoveDirReq(filepath.Join(filepath.Dir(filename), "archivefs"))
+		os.Remove(filename)
+	}()
+	r, err := Open(filename, Options{Limits: DefaultLimits})
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer r.Close()
+
+	fsys := r.FS(FSOptions{})
+	err = fstest.TestFS(fsys, "bin/java", "lib/empty.txt", "lib/rt.jar/java/lang/Object.class", "lib/rt.jar/bin/copy", "web/page.html")
+	if err != nil {
+		T.Fatal(err)
+	}
+	if fi, err := fs.Stat(fsys, "lib/rt.jar"); err != nil || !fi.IsDir() {
+		T.Errorf("Container is not the directory: %v", err)
+	}
+
+	files := 0
+	err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files++
+		}
+		return err
+	})
+	if err != nil || files != 6 {
+		T.Errorf("Walked %d files: %v", files, err)
+	}
+
+	t, err := template.ParseFS(fsys, "web/*.html")
+	if err != nil {
+		T.Fatal(err)
+	}
+	var page bytes.Buffer
+	if err := t.Execute(&page, "hello"); err != nil || page.String() != "<p>hello</p>" {
+		T.Errorf("Unexpected page %q: %v", page.String(), err)
+	}
+
+	server := httptest.NewServer(http.FileServer(http.FS(fsys)))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/bin/java")
+	if err != nil {
+		T.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "java launcher" {
+		T.Errorf("Unexpected response %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestFSRebuildContainers(T *testing.T) {
+	filename := packTestTree(T, "archivefsrebuild", packer.Options{})
+	defer func() {
+		common.RemoveDirReq(filepath.Join(filepath.Dir(filename), "archivefsrebuild"))
+		os.Remove(filename)
+	}()
+	r, err := Open(filename, Options{Limits: DefaultLimits})
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer r.Close()
+
+	fsys := r.FS(FSOptions{RebuildContainers: true})
+	err = fstest.TestFS(fsys, "bin/java", "lib/rt.jar", "web/page.html")
+	if err != nil {
+		T.Fatal(err)
+	}
+	if _, err := fs.Stat(fsys, "lib/rt.jar/bin/copy"); err == nil {
+		T.Error("Entry of the rebuilt container is visible")
+	}
+
+	b, err := fs.ReadFile(fsys, "lib/rt.jar")
+	if err != nil {
+		T.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		T.Fatal(err)
+	}
+	entries := make(map[string]string)
+	for _, zf := range zr.File {
+		rc, err := zf.Open()
+		if err != nil {
+			T.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		entries[zf.Name] = string(data)
+	}
+	if entries["java/lang/Object.class"] != "class Object" || entries["bin/copy"] != "java launcher" {
+		T.Errorf("Unexpected rebuilt container %v", entries)
+	}
+	if fi, err := fs.Stat(fsys, "lib/rt.jar"); err != nil || fi.IsDir() || fi.Size() != int64(len(b)) {
+		T.Errorf("Unexpected container info %v: %v", fi, err)
+	}
+}
@@ -28,25 +28,27 @@ import (
 // CommandlineUI struct is concrete and simple UI implementation
 type CommandlineUI struct {
 	Archivefile string
+
+	percentage int
 }
 
 // Error will produce panic
-func (u CommandlineUI) Error(message string) {
+func (u *CommandlineUI) Error(message string) {
 	panic(message)
 }
 
 // Fatal will produce panic
-func (u CommandlineUI) Fatal(message string) {
+func (u *CommandlineUI) Fatal(message string) {
 	panic(message)
 }
 
 // Info will Println message
-func (u CommandlineUI) Info(message string) {
+func (u *CommandlineUI) Info(message string) {
 	fmt.Println(message)
 }
 
 // OnEnd will Println simple info message
-func (u CommandlineUI) OnEnd(eventid int) {
+func (u *CommandlineUI) OnEnd(eventid int) {
 	switch eventid {
 	case ui.EvtUnpackDone:
 		fmt.Println("Unpacking complete.")
@@ -61,27 +63,25 @@ func (u CommandlineUI) OnEnd(eventid int) {
 }
 
 // Hashed will do nothing
-func (u CommandlineUI) Hashed(info ui.Hash) {
+func (u *CommandlineUI) Hashed(info ui.Hash) {
 
 }
 
 // NewFolder will do nothing
-func (u CommandlineUI) NewFolder(info ui.Folder) {
+func (u *CommandlineUI) NewFolder(info ui.Folder) {
 
 }
 
 // Compress will do nothing
-func (u CommandlineUI) Compress(info ui.Compressed) {
+func (u *CommandlineUI) Compress(info ui.Compressed) {
 
 }
 
-var percentage int
-
 // Unpack will Print compressed files percentage on percents change
-func (u CommandlineUI) Unpack(readedFolders, foldersNum int) {
+func (u *CommandlineUI) Unpack(readedFolders, foldersNum int) {
 	p := int(readedFolders * 100 / foldersNum)
-	if p != percentage {
+	if p != u.percentage {
 		fmt.Printf("Unpacking: %d%%\n", p)
-		percentage = p
+		u.percentage = p
 	}
 }
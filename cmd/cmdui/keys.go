@@ -0,0 +1,54 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmdui
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"strings"
+
+	"github.com/alexript/jrepack"
+)
+
+// KeysFlag is the list of the public key files, given by the repeated flag
+type KeysFlag []ed25519.PublicKey
+
+func (k *KeysFlag) String() string {
+	return strings.Repeat("key ", len(*k))
+}
+
+// Set will read the public key file
+func (k *KeysFlag) Set(filename string) error {
+	key, err := jrepack.ReadPublicKey(filename)
+	if err != nil {
+		return err
+	}
+	*k = append(*k, key)
+	return nil
+}
+
+// SignatureFlags will define command line flags for the signature verification
+func SignatureFlags(flags *flag.FlagSet) *jrepack.UnPackOptions {
+	options := &jrepack.UnPackOptions{}
+	flags.Var((*KeysFlag)(&options.PublicKeys), "pub", "trusted public key `file`, may be repeated")
+	flags.BoolVar(&options.RequireSignature, "require-signature", false, "refuse archives without signature of the trusted key")
+	flags.StringVar(&options.SignatureFile, "signature", "", "detached signature `file`, archive name + .sig by default")
+	return options
+}
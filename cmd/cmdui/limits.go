@@ -0,0 +1,38 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmdui
+
+import (
+	"flag"
+
+	"github.com/alexript/jrepack"
+)
+
+// LimitFlags will define command line flags for the resource limits.
+// Default values are jrepack.DefaultLimits, zero value disables the limit.
+func LimitFlags(flags *flag.FlagSet) *jrepack.Limits {
+	limits := jrepack.DefaultLimits
+	flags.Int64Var(&limits.MaxTotalSize, "max-size", limits.MaxTotalSize, "maximum number of the unpacked bytes, 0 for no limit")
+	flags.Int64Var(&limits.MaxFileSize, "max-file", limits.MaxFileSize, "maximum size of the single file, 0 for no limit")
+	flags.IntVar(&limits.MaxEntries, "max-entries", limits.MaxEntries, "maximum number of the archive entries, 0 for no limit")
+	flags.IntVar(&limits.MaxDepth, "max-depth", limits.MaxDepth, "maximum depth of the paths, 0 for no limit")
+	flags.Int64Var(&limits.MaxHeaderSize, "max-header", limits.MaxHeaderSize, "maximum size of the archive header, 0 for no limit")
+	return &limits
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmdui
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// PasswordEnv is the environment variable with the password of the encrypted archive
+const PasswordEnv = "JREPACK_PASSWORD"
+
+// PasswordFlag will define command line flag for the password file of the
+// encrypted archive. Password is not given on the command line, so it is not
+// visible in the process list.
+func PasswordFlag(flags *flag.FlagSet) *string {
+	return flags.String("password-file", "", "read password of the encrypted archive from the `file`, "+PasswordEnv+" environment variable is used by default")
+}
+
+// ReadPassword will read password from the first line of the file. Password
+// from the environment variable is returned, when file name is empty.
+func ReadPassword(filename string) (string, error) {
+	if filename == "" {
+		return os.Getenv(PasswordEnv), nil
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read password: %v", err)
+	}
+	password := strings.SplitN(string(b), "\n", 2)[0]
+	return strings.TrimSuffix(password, "\r"), nil
+}
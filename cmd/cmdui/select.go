@@ -0,0 +1,70 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmdui
+
+import (
+	"flag"
+	"regexp"
+	"strings"
+
+	"github.com/alexript/jrepack"
+)
+
+// StringsFlag is the list of the values, given by the repeated flag
+type StringsFlag []string
+
+func (s *StringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set will append the value
+func (s *StringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// RegexpsFlag is the list of the regular expressions, given by the repeated flag
+type RegexpsFlag []*regexp.Regexp
+
+func (r *RegexpsFlag) String() string {
+	patterns := make([]string, len(*r))
+	for i, re := range *r {
+		patterns[i] = re.String()
+	}
+	return strings.Join(patterns, ",")
+}
+
+// Set will compile the regular expression
+func (r *RegexpsFlag) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, re)
+	return nil
+}
+
+// SelectFlags will define command line flags for the selective unpacking
+func SelectFlags(flags *flag.FlagSet) *jrepack.Selector {
+	selector := &jrepack.Selector{}
+	flags.Var((*StringsFlag)(&selector.Globs), "glob", "unpack entries, which match the glob `pattern`, may be repeated; pattern without slash is matched against the name")
+	flags.Var((*RegexpsFlag)(&selector.Regexps), "regexp", "unpack entries, which full path matches the regular `expression`, may be repeated")
+	return selector
+}
@@ -20,56 +20,47 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
-	"log"
 	"os"
-	"runtime"
-	"runtime/pprof"
 
 	"github.com/alexript/jrepack"
 	"github.com/alexript/jrepack/cmd/cmdui"
-	"github.com/alexript/jrepack/ui"
 )
 
-var (
-	outputFolder = `D:\workspace\ETax-2.0\runtimes\runtime\jre8u172_unpacked`
-	inputFile    = `D:\workspace\ETax-2.0\runtimes\runtime\jre8u172_stable.jre`
-)
-
-var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
-var memprofile = flag.String("memprofile", "", "write memory profile to `file`")
+// audit will compare the installed folder with the archive and print the report
+func audit(flags *flag.FlagSet, args []string) error {
+	asJSON := flags.Bool("json", false, "print the report as json")
+	limits := cmdui.LimitFlags(flags)
+	passwordFile := cmdui.PasswordFlag(flags)
+	err := parseArgs(flags, args, 2)
+	if err != nil {
+		return err
+	}
 
-func main() {
-	flag.Parse()
-	if *cpuprofile != "" {
-		f, err := os.Create(*cpuprofile)
-		if err != nil {
-			log.Fatal("could not create CPU profile: ", err)
-		}
-		if err := pprof.StartCPUProfile(f); err != nil {
-			log.Fatal("could not start CPU profile: ", err)
-		}
-		defer pprof.StopCPUProfile()
+	options := jrepack.UnPackOptions{Limits: *limits}
+	options.Password, err = cmdui.ReadPassword(*passwordFile)
+	if err != nil {
+		return err
 	}
 
-	ui.Set(cmdui.CommandlineUI{
-		Archivefile: inputFile,
-	})
-	err := jrepack.UnPack(inputFile, outputFolder)
+	report, err := jrepack.Audit(flags.Arg(0), flags.Arg(1), options)
 	if err != nil {
-		ui.Current().Error(fmt.Sprintf("jre unpack error: %v", err))
-		return
+		return err
 	}
-	if *memprofile != "" {
-		f, err := os.Create(*memprofile)
+	if *asJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		err = e.Encode(report)
 		if err != nil {
-			log.Fatal("could not create memory profile: ", err)
+			return err
 		}
-		runtime.GC() // get up-to-date statistics
-		if err := pprof.WriteHeapProfile(f); err != nil {
-			log.Fatal("could not write memory profile: ", err)
-		}
-		f.Close()
+	} else {
+		fmt.Print(report)
+	}
+	if !report.OK() {
+		return errFailed
 	}
+	return nil
 }
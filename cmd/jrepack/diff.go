@@ -0,0 +1,59 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/alexript/jrepack"
+	"github.com/alexript/jrepack/cmd/cmdui"
+)
+
+// diff will print the difference of the files of two archives
+func diff(flags *flag.FlagSet, args []string) error {
+	asJSON := flags.Bool("json", false, "print the difference as json")
+	limits := cmdui.LimitFlags(flags)
+	passwordFile := cmdui.PasswordFlag(flags)
+	err := parseArgs(flags, args, 2)
+	if err != nil {
+		return err
+	}
+
+	options := jrepack.UnPackOptions{Limits: *limits}
+	options.Password, err = cmdui.ReadPassword(*passwordFile)
+	if err != nil {
+		return err
+	}
+
+	d, err := jrepack.DiffArchives(flags.Arg(0), flags.Arg(1), options)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(d)
+	}
+	fmt.Print(d)
+	return nil
+}
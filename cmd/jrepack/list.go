@@ -0,0 +1,184 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/alexript/jrepack"
+	"github.com/alexript/jrepack/cmd/cmdui"
+)
+
+// list will print the archive entries in the flat, long or tree format
+func list(flags *flag.FlagSet, args []string) error {
+	format := flags.String("format", "flat", "output `format`: flat, long or tree")
+	glob := flags.String("glob", "", "list only entries, which match the glob `pattern`; pattern without slash is matched against the name")
+	order := flags.String("sort", "header", "sort `order`: header or size")
+	limits := cmdui.LimitFlags(flags)
+	passwordFile := cmdui.PasswordFlag(flags)
+	err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	if (*format != "flat" && *format != "long" && *format != "tree") || (*order != "header" && *order != "size") {
+		flags.Usage()
+		return errUsage
+	}
+
+	options := jrepack.UnPackOptions{Limits: *limits}
+	options.Password, err = cmdui.ReadPassword(*passwordFile)
+	if err != nil {
+		return err
+	}
+
+	all, err := jrepack.List(flags.Arg(0), options)
+	if err != nil {
+		return err
+	}
+	entries := all
+	if *glob != "" {
+		entries, err = jrepack.MatchEntries(all, *glob)
+		if err != nil {
+			fmt.Fprintf(flags.Output(), "Invalid glob pattern %q: %v\n", *glob, err)
+			return errUsage
+		}
+	}
+
+	bySize := *order == "size"
+	switch *format {
+	case "tree":
+		printTree(all, entries, bySize)
+	case "long":
+		if bySize {
+			jrepack.SortBySize(entries)
+		}
+		for _, e := range entries {
+			fmt.Println(longEntry(e))
+		}
+	default:
+		if bySize {
+			jrepack.SortBySize(entries)
+		}
+		for _, e := range entries {
+			fmt.Println(entryName(e, e.Path))
+		}
+	}
+	return nil
+}
+
+// entryName will end names of the folders and containers by slash
+func entryName(e jrepack.Entry, name string) string {
+	if e.Folder || e.Container {
+		return name + "/"
+	}
+	return name
+}
+
+// longEntry is the line of the long format: type, size, shared flag, hash and path.
+// Type is d for folder, c for container and f for file.
+func longEntry(e jrepack.Entry) string {
+	kind := "f"
+	switch {
+	case e.Folder:
+		kind = "d"
+	case e.Container:
+		kind = "c"
+	}
+	shared := "-"
+	if e.Shared {
+		shared = "shared"
+	}
+	hash := "-"
+	if e.Hash != nil {
+		hash = hex.EncodeToString(e.Hash)
+	}
+	return fmt.Sprintf("%s %12d %-6s %-64s %s", kind, e.Size, shared, hash, entryName(e, e.Path))
+}
+
+// node is the entry of the tree with its children
+type node struct {
+	entry    jrepack.Entry
+	size     uint64
+	children []*node
+}
+
+// printTree will print matched entries with their parent folders as the tree.
+// Size of the folder is the size of the listed files inside of it.
+func printTree(all []jrepack.Entry, matched []jrepack.Entry, bySize bool) {
+	known := make(map[string]jrepack.Entry, len(all))
+	for _, e := range all {
+		known[e.Path] = e
+	}
+
+	root := &node{}
+	nodes := map[string]*node{"": root}
+	var add func(p string) *node
+	add = func(p string) *node {
+		if n, ok := nodes[p]; ok {
+			return n
+		}
+		n := &node{entry: known[p]}
+		n.entry.Path = p
+		nodes[p] = n
+		parent := path.Dir(p)
+		if parent == "." {
+			parent = ""
+		}
+		pn := add(parent)
+		pn.children = append(pn.children, n)
+		return n
+	}
+	for _, e := range matched {
+		add(e.Path)
+	}
+
+	var size func(n *node) uint64
+	size = func(n *node) uint64 {
+		n.size = uint64(n.entry.Size)
+		for _, c := range n.children {
+			n.size += size(c)
+		}
+		if bySize {
+			sort.SliceStable(n.children, func(i, j int) bool {
+				return n.children[i].size > n.children[j].size
+			})
+		}
+		return n.size
+	}
+	size(root)
+
+	var print func(n *node, depth int)
+	print = func(n *node, depth int) {
+		for _, c := range n.children {
+			name := entryName(c.entry, path.Base(c.entry.Path))
+			if c.entry.Shared {
+				name += " (shared)"
+			}
+			fmt.Printf("%s%s %d\n", strings.Repeat("  ", depth), name, c.size)
+			print(c, depth+1)
+		}
+	}
+	print(root, 0)
+}
@@ -0,0 +1,245 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Command jrepack will pack, unpack, list, verify and describe the jre archives.
+
+Usage:
+
+	jrepack [-cpuprofile file] [-memprofile file] command [flags] arguments
+
+Commands are pack, unpack, list, verify, audit, diff, stats, info, sign and
+keygen. Use "jrepack help command" for the flags and arguments of the command.
+
+Exit code is 0 on success, 1 for the corrupted, damaged or rejected archive and
+for the failed verification or audit, 2 for the wrong usage and 3 for the I/O
+and other errors.
+
+Interrupted or terminated pack and unpack remove the partial archive file or
+output folder.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"syscall"
+
+	"github.com/alexript/jrepack"
+)
+
+const (
+	exitOK        = 0
+	exitCorrupted = 1
+	exitUsage     = 2
+	exitIO        = 3
+)
+
+var (
+	// errUsage is the error for the wrong command line, usage is already printed
+	errUsage = errors.New("wrong usage")
+
+	// errFailed is the error for the failed verification or audit, report is already printed
+	errFailed = errors.New("check failed")
+)
+
+// command is the subcommand of jrepack
+type command struct {
+	name string
+	args string
+	help string
+	run  func(flags *flag.FlagSet, args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"pack", "folder archive", "Pack the jre folder into the new archive file.", pack},
+		{"unpack", "archive folder [path ...]", "Unpack the archive or the selected paths into the new folder.", unpack},
+		{"list", "archive", "List files of the archive, files of the containers are listed too.", list},
+		{"verify", "archive", "Check checksums, signature and every file of the archive without unpacking.", verify},
+		{"audit", "archive folder", "Compare the installed folder with the archive, nothing is written.", audit},
+		{"diff", "old new", "Print files, added, removed, changed and renamed in the new archive.", diff},
+		{"stats", "archive", "Print deduplication and compression statistics, read from the archive header.", stats},
+		{"info", "archive", "Print the summary of the archive, read from the archive header.", info},
+		{"sign", "key archive", "Sign the archive by the private key file.", sign},
+		{"keygen", "name", "Write the new name.key private and name.pub public key files.", keygen},
+		{"help", "[command]", "Print help of the command.", help},
+	}
+}
+
+var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
+var memprofile = flag.String("memprofile", "", "write memory profile to `file`")
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: jrepack [flags] command [command flags] arguments\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", c.name, c.help)
+	}
+	fmt.Fprintf(out, "\nExit codes: 0 success, 1 corrupted or rejected archive or failed check, 2 wrong usage, 3 I/O error.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// newFlagSet will create flags of the command with the command usage
+func newFlagSet(c *command) *flag.FlagSet {
+	flags := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "Usage: jrepack %s [flags] %s\n\n%s\n", c.name, c.args, c.help)
+		n := 0
+		flags.VisitAll(func(*flag.Flag) { n++ })
+		if n > 0 {
+			fmt.Fprintf(out, "\nFlags:\n")
+			flags.PrintDefaults()
+		}
+	}
+	return flags
+}
+
+// parseArgs will parse flags of the command and check the number of the arguments
+func parseArgs(flags *flag.FlagSet, args []string, n int) error {
+	err := flags.Parse(args)
+	if err == flag.ErrHelp {
+		return err
+	}
+	if err != nil {
+		return errUsage
+	}
+	if flags.NArg() != n {
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// interruptContext will return the context, which is done on the interrupt or
+// terminate signal, so the partial output is removed before the exit
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// exitCode will classify the error of the command
+func exitCode(err error) int {
+	var hashErr *jrepack.HashError
+	switch {
+	case err == nil || err == flag.ErrHelp:
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case err == errFailed,
+		errors.Is(err, jrepack.ErrCorrupted),
+		errors.Is(err, jrepack.ErrUnsafePath),
+		errors.Is(err, jrepack.ErrLimit),
+		errors.Is(err, jrepack.ErrUnsigned),
+		errors.Is(err, jrepack.ErrSignature),
+		errors.Is(err, jrepack.ErrEncrypted),
+		errors.Is(err, jrepack.ErrPassword),
+		errors.As(err, &hashErr):
+		return exitCorrupted
+	}
+	return exitIO
+}
+
+func help(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err != nil || flags.NArg() > 1 {
+		return errUsage
+	}
+	c := findCommand(flags.Arg(0))
+	if c == nil || c.name == "help" {
+		flag.CommandLine.SetOutput(os.Stdout)
+		usage()
+		return nil
+	}
+	// flags of the command are defined by its run function
+	flags = newFlagSet(c)
+	flags.SetOutput(os.Stdout)
+	return c.run(flags, []string{"-h"})
+}
+
+func run() int {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		return exitUsage
+	}
+	c := findCommand(flag.Arg(0))
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "jrepack: unknown command %q\n", flag.Arg(0))
+		usage()
+		return exitUsage
+	}
+
+	if *cpuprofile != "" {
+		f, err := os.Create(*cpuprofile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "jrepack: could not create CPU profile: %v\n", err)
+			return exitIO
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Fprintf(os.Stderr, "jrepack: could not start CPU profile: %v\n", err)
+			return exitIO
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	err := c.run(newFlagSet(c), flag.Args()[1:])
+	code := exitCode(err)
+	if code != exitOK && err != errUsage && err != errFailed {
+		fmt.Fprintf(os.Stderr, "jrepack %s error: %v\n", c.name, err)
+	}
+
+	if *memprofile != "" {
+		f, err := os.Create(*memprofile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "jrepack: could not create memory profile: %v\n", err)
+			return exitIO
+		}
+		defer f.Close()
+		runtime.GC() // get up-to-date statistics
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			fmt.Fprintf(os.Stderr, "jrepack: could not write memory profile: %v\n", err)
+			return exitIO
+		}
+	}
+	return code
+}
+
+func main() {
+	os.Exit(run())
+}
@@ -21,60 +21,58 @@ package main
 
 import (
 	"flag"
-	"fmt"
-	"log"
-	"os"
-	"runtime"
-	"runtime/pprof"
-
-	_ "net/http/pprof"
 
 	"github.com/alexript/jrepack"
 	"github.com/alexript/jrepack/cmd/cmdui"
-	"github.com/alexript/jrepack/ui"
-)
-
-var (
-	inputFolder = `D:\workspace\ETax-2.0\runtimes\runtime\jre8u172_stable`
-	outputFile  = `D:\workspace\ETax-2.0\runtimes\runtime\jre8u172_stable.jre`
 )
 
-var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
-var memprofile = flag.String("memprofile", "", "write memory profile to `file`")
+// pack will pack the folder into the archive
+func pack(flags *flag.FlagSet, args []string) error {
+	dumpheader := flags.Bool("dumpheader", false, "write binary and json header dumps near the archive file")
+	classes := flags.Bool("classes", false, "group and split java classes before compression")
+	bcjfilter := flags.Bool("bcj", false, "apply branch converter to the native libraries before compression")
+	dictionary := flags.Bool("dict", false, "compress small files in independent frames with the trained dictionary")
+	auto := flags.Bool("auto", false, "try several codecs for every data segment and keep the smallest result")
+	budget := flags.Duration("budget", jrepack.DefaultAutoBudget, "time budget of the codec selection for one data segment")
+	printstats := flags.Bool("stats", false, "print deduplication and compression statistics of the new archive")
+	statsJSON := flags.Bool("json", false, "print statistics as json")
+	signkey := flags.String("sign", "", "sign archive by the private key `file`")
+	passwordFile := cmdui.PasswordFlag(flags)
+	var metadata cmdui.MetadataFlag
+	flags.Var(&metadata, "meta", "store `key=value` metadata in the archive header, may be repeated")
+	err := parseArgs(flags, args, 2)
+	if err != nil {
+		return err
+	}
 
-// TODO: write doc
-func main() {
-	flag.Parse()
-	if *cpuprofile != "" {
-		f, err := os.Create(*cpuprofile)
+	options := jrepack.PackOptions{
+		DumpHeader:     *dumpheader,
+		ClassTransform: *classes,
+		BranchFilter:   *bcjfilter,
+		Dictionary:     *dictionary,
+		Auto:           *auto,
+		AutoBudget:     *budget,
+		Metadata:       jrepack.Properties(metadata),
+	}
+	if *signkey != "" {
+		options.SigningKey, err = jrepack.ReadPrivateKey(*signkey)
 		if err != nil {
-			log.Fatal("could not create CPU profile: ", err)
-		}
-		if err := pprof.StartCPUProfile(f); err != nil {
-			log.Fatal("could not start CPU profile: ", err)
+			return err
 		}
-		defer pprof.StopCPUProfile()
 	}
-
-	ui.Set(cmdui.CommandlineUI{
-		Archivefile: outputFile,
-	})
-	err := jrepack.Pack(inputFolder, outputFile, false)
+	options.Password, err = cmdui.ReadPassword(*passwordFile)
 	if err != nil {
-		ui.Current().Error(fmt.Sprintf("jre pack error: %v", err))
-
-		return
+		return err
 	}
 
-	if *memprofile != "" {
-		f, err := os.Create(*memprofile)
-		if err != nil {
-			log.Fatal("could not create memory profile: ", err)
-		}
-		runtime.GC() // get up-to-date statistics
-		if err := pprof.WriteHeapProfile(f); err != nil {
-			log.Fatal("could not write memory profile: ", err)
-		}
-		f.Close()
+	options.UI = &cmdui.CommandlineUI{
+		Archivefile: flags.Arg(1),
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	err = jrepack.PackContext(ctx, flags.Arg(0), flags.Arg(1), options)
+	if err != nil || !*printstats {
+		return err
 	}
+	return printStats(flags.Arg(1), jrepack.UnPackOptions{Limits: jrepack.DefaultLimits, Password: options.Password}, *statsJSON)
 }
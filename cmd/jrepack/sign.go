@@ -0,0 +1,60 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"flag"
+
+	"github.com/alexript/jrepack"
+)
+
+// sign will sign the archive by the embedded or detached signature
+func sign(flags *flag.FlagSet, args []string) error {
+	detached := flags.Bool("detached", false, "write signature into archive name + .sig file")
+	err := parseArgs(flags, args, 2)
+	if err != nil {
+		return err
+	}
+
+	key, err := jrepack.ReadPrivateKey(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return jrepack.SignArchive(flags.Arg(1), key, *detached)
+}
+
+// keygen will write the new key pair
+func keygen(flags *flag.FlagSet, args []string) error {
+	err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	public, private, err := jrepack.GenerateKey()
+	if err != nil {
+		return err
+	}
+	name := flags.Arg(0)
+	err = jrepack.WriteKey(name+".key", private)
+	if err != nil {
+		return err
+	}
+	return jrepack.WriteKey(name+".pub", public)
+}
@@ -0,0 +1,62 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/alexript/jrepack"
+	"github.com/alexript/jrepack/cmd/cmdui"
+)
+
+// stats will print deduplication and compression statistics of the archive
+func stats(flags *flag.FlagSet, args []string) error {
+	asJSON := flags.Bool("json", false, "print statistics as json")
+	limits := cmdui.LimitFlags(flags)
+	passwordFile := cmdui.PasswordFlag(flags)
+	err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	options := jrepack.UnPackOptions{Limits: *limits}
+	options.Password, err = cmdui.ReadPassword(*passwordFile)
+	if err != nil {
+		return err
+	}
+	return printStats(flags.Arg(0), options, *asJSON)
+}
+
+func printStats(filename string, options jrepack.UnPackOptions, asJSON bool) error {
+	s, err := jrepack.ReadStats(filename, options)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(s)
+	}
+	fmt.Print(s)
+	return nil
+}
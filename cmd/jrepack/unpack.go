@@ -0,0 +1,74 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/alexript/jrepack"
+	"github.com/alexript/jrepack/cmd/cmdui"
+)
+
+// unpack will unpack the archive into the new folder
+func unpack(flags *flag.FlagSet, args []string) error {
+	lenient := flags.Bool("lenient", false, "write files with the wrong hash summ and report them")
+	limits := cmdui.LimitFlags(flags)
+	signature := cmdui.SignatureFlags(flags)
+	passwordFile := cmdui.PasswordFlag(flags)
+	selector := cmdui.SelectFlags(flags)
+	unwrap := flags.Bool("unwrap", false, "write entries of the containers as the files of the folder with the container name")
+	err := flags.Parse(args)
+	if err == flag.ErrHelp {
+		return err
+	}
+	if err != nil {
+		return errUsage
+	}
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errUsage
+	}
+
+	options := *signature
+	options.Lenient = *lenient
+	options.Limits = *limits
+	options.Unwrap = *unwrap
+	selector.Paths = flags.Args()[2:]
+	if len(selector.Paths) > 0 || len(selector.Globs) > 0 || len(selector.Regexps) > 0 {
+		err = selector.Validate()
+		if err != nil {
+			fmt.Fprintf(flags.Output(), "Invalid glob pattern: %v\n", err)
+			return errUsage
+		}
+		options.Select = selector
+	}
+	options.Password, err = cmdui.ReadPassword(*passwordFile)
+	if err != nil {
+		return err
+	}
+
+	options.UI = &cmdui.CommandlineUI{
+		Archivefile: flags.Arg(0),
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	return jrepack.UnPackContext(ctx, flags.Arg(0), flags.Arg(1), options)
+}
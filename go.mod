@@ -1,3 +1,5 @@
 module github.com/alexript/jrepack
 
-require github.com/itchio/lzma v0.0.0-20190703113020-d3e24e3e3d49
+go 1.17
+
+require golang.org/x/crypto v0.9.0
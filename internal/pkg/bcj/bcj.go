@@ -0,0 +1,239 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package bcj is the branch converters for the native executables.
+
+Relative addresses of the call and branch instructions are converted into the
+absolute ones. Calls of the same function become the same bytes, so native
+libraries are compressed better. Filters are reversible and do not change the
+data size.
+*/
+package bcj
+
+import (
+	"encoding/binary"
+)
+
+const (
+	// None is the unfiltered data
+	None uint8 = 0
+
+	// X86 is the filter for the x86 and x86-64 code
+	X86 uint8 = 1
+
+	// ARM64 is the filter for the ARM64 code
+	ARM64 uint8 = 2
+)
+
+const (
+	elfMachine386     = 0x03
+	elfMachineAMD64   = 0x3E
+	elfMachineAArch64 = 0xB7
+
+	peMachine386   = 0x014C
+	peMachineAMD64 = 0x8664
+	peMachineARM64 = 0xAA64
+
+	machoMagic32    = 0xFEEDFACE
+	machoMagic64    = 0xFEEDFACF
+	machoCPU386     = 0x00000007
+	machoCPUAMD64   = 0x01000007
+	machoCPUARM64   = 0x0100000C
+	machoCPUARM6432 = 0x0200000C
+)
+
+// Detect will return the filter for ELF, PE or Mach-O executable.
+func Detect(b []byte) uint8 {
+	switch {
+	case len(b) >= 20 && string(b[0:4]) == "\x7fELF":
+		var order binary.ByteOrder = binary.LittleEndian
+		if b[5] == 2 {
+			order = binary.BigEndian
+		}
+		switch order.Uint16(b[18:20]) {
+		case elfMachine386, elfMachineAMD64:
+			return X86
+		case elfMachineAArch64:
+			return ARM64
+		}
+
+	case len(b) >= 0x40 && string(b[0:2]) == "MZ":
+		pe := int(binary.LittleEndian.Uint32(b[0x3C:0x40]))
+		if pe < 0x40 || pe > len(b)-6 || string(b[pe:pe+4]) != "PE\x00\x00" {
+			return None
+		}
+		switch binary.LittleEndian.Uint16(b[pe+4 : pe+6]) {
+		case peMachine386, peMachineAMD64:
+			return X86
+		case peMachineARM64:
+			return ARM64
+		}
+
+	case len(b) >= 8:
+		magic := binary.LittleEndian.Uint32(b[0:4])
+		if magic != machoMagic32 && magic != machoMagic64 {
+			return None
+		}
+		switch binary.LittleEndian.Uint32(b[4:8]) {
+		case machoCPU386, machoCPUAMD64:
+			return X86
+		case machoCPUARM64, machoCPUARM6432:
+			return ARM64
+		}
+	}
+	return None
+}
+
+// Supported check the filter value
+func Supported(filter uint8) bool {
+	return filter == None || filter == X86 || filter == ARM64
+}
+
+// Encode will apply the filter to the data in place.
+func Encode(filter uint8, b []byte) {
+	code(filter, b, true)
+}
+
+// Decode will revert the filter of the data in place.
+func Decode(filter uint8, b []byte) {
+	code(filter, b, false)
+}
+
+func code(filter uint8, b []byte, isEncoder bool) {
+	switch filter {
+	case X86:
+		x86(b, isEncoder)
+	case ARM64:
+		arm64(b, isEncoder)
+	}
+}
+
+func test86MSByte(b byte) bool {
+	return b == 0 || b == 0xFF
+}
+
+// x86 converts relative addresses of CALL (E8) and JMP (E9) instructions.
+// It is the same filter as x86 BCJ filter of xz.
+func x86(b []byte, isEncoder bool) {
+	maskToAllowedStatus := [8]bool{true, true, true, false, true, false, false, false}
+	maskToBitNumber := [8]uint32{0, 1, 2, 2, 3, 3, 3, 3}
+
+	if len(b) < 5 {
+		return
+	}
+
+	prevMask := uint32(0)
+	prevPos := ^uint32(4) // -5
+	limit := len(b) - 5
+
+	for pos := 0; pos <= limit; {
+		c := b[pos]
+		if c != 0xE8 && c != 0xE9 {
+			pos++
+			continue
+		}
+
+		offset := uint32(pos) - prevPos
+		prevPos = uint32(pos)
+
+		if offset > 5 {
+			prevMask = 0
+		} else {
+			for i := uint32(0); i < offset; i++ {
+				prevMask &= 0x77
+				prevMask <<= 1
+			}
+		}
+
+		c = b[pos+4]
+		if test86MSByte(c) && maskToAllowedStatus[(prevMask>>1)&0x7] && (prevMask>>1) < 0x10 {
+			src := binary.LittleEndian.Uint32(b[pos+1 : pos+5])
+			var dest uint32
+			for {
+				if isEncoder {
+					dest = src + uint32(pos) + 5
+				} else {
+					dest = src - (uint32(pos) + 5)
+				}
+				if prevMask == 0 {
+					break
+				}
+				i := maskToBitNumber[prevMask>>1]
+				c = byte(dest >> (24 - i*8))
+				if !test86MSByte(c) {
+					break
+				}
+				src = dest ^ (1<<(32-i*8) - 1)
+			}
+
+			dest &= 0x01FFFFFF
+			if dest&0x01000000 != 0 {
+				dest |= 0xFF000000
+			}
+			binary.LittleEndian.PutUint32(b[pos+1:pos+5], dest)
+			pos += 5
+			prevMask = 0
+		} else {
+			pos++
+			prevMask |= 1
+			if test86MSByte(c) {
+				prevMask |= 0x10
+			}
+		}
+	}
+}
+
+// arm64 converts addresses of BL and ADRP instructions.
+// It is the same filter as ARM64 BCJ filter of xz.
+func arm64(b []byte, isEncoder bool) {
+	for i := 0; i+4 <= len(b); i += 4 {
+		pc := uint32(i)
+		instr := binary.LittleEndian.Uint32(b[i : i+4])
+
+		if instr>>26 == 0x25 {
+			// BL instruction
+			src := instr
+			pc >>= 2
+			if !isEncoder {
+				pc = -pc
+			}
+			instr = 0x94000000 | (src+pc)&0x03FFFFFF
+			binary.LittleEndian.PutUint32(b[i:i+4], instr)
+
+		} else if instr&0x9F000000 == 0x90000000 {
+			// ADRP instruction
+			src := (instr>>29)&3 | (instr>>3)&0x001FFFFC
+			if (src+0x00020000)&0x001C0000 != 0 {
+				continue
+			}
+
+			instr &= 0x9000001F
+			pc >>= 12
+			if !isEncoder {
+				pc = -pc
+			}
+			dest := src + pc
+			instr |= (dest & 3) << 29
+			instr |= (dest & 0x0003FFFC) << 3
+			instr |= -(dest & 0x00020000) & 0x00E00000
+			binary.LittleEndian.PutUint32(b[i:i+4], instr)
+		}
+	}
+}
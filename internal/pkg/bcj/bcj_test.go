@@ -0,0 +1,203 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package bcj
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func roundtrip(T *testing.T, filter uint8, data []byte) []byte {
+	b := append([]byte(nil), data...)
+	Encode(filter, b)
+	encoded := append([]byte(nil), b...)
+	Decode(filter, b)
+	if !bytes.Equal(data, b) {
+		T.Errorf("Filter %d is not reversible", filter)
+	}
+	return encoded
+}
+
+func TestDetectHeaders(T *testing.T) {
+	elf := func(class, data byte, machine uint16) []byte {
+		b := make([]byte, 64)
+		copy(b, "\x7fELF")
+		b[4], b[5] = class, data
+		if data == 2 {
+			binary.BigEndian.PutUint16(b[18:], machine)
+		} else {
+			binary.LittleEndian.PutUint16(b[18:], machine)
+		}
+		return b
+	}
+	pe := func(machine uint16) []byte {
+		b := make([]byte, 0x100)
+		copy(b, "MZ")
+		binary.LittleEndian.PutUint32(b[0x3C:], 0x80)
+		copy(b[0x80:], "PE\x00\x00")
+		binary.LittleEndian.PutUint16(b[0x84:], machine)
+		return b
+	}
+	macho := func(magic, cpu uint32) []byte {
+		b := make([]byte, 32)
+		binary.LittleEndian.PutUint32(b, magic)
+		binary.LittleEndian.PutUint32(b[4:], cpu)
+		return b
+	}
+
+	cases := []struct {
+		name     string
+		data     []byte
+		expected uint8
+	}{
+		{"elf amd64", elf(2, 1, elfMachineAMD64), X86},
+		{"elf 386", elf(1, 1, elfMachine386), X86},
+		{"elf arm64", elf(2, 1, elfMachineAArch64), ARM64},
+		{"elf big endian arm64", elf(2, 2, elfMachineAArch64), ARM64},
+		{"elf sparc", elf(2, 2, 0x2B), None},
+		{"pe amd64", pe(peMachineAMD64), X86},
+		{"pe arm64", pe(peMachineARM64), ARM64},
+		{"pe broken", pe(peMachineAMD64)[:0x82], None},
+		{"macho amd64", macho(machoMagic64, machoCPUAMD64), X86},
+		{"macho arm64", macho(machoMagic64, machoCPUARM64), ARM64},
+		{"class", []byte{0xCA, 0xFE, 0xBA, 0xBE, 0, 0, 0, 52}, None},
+		{"text", []byte("Manifest-Version: 1.0"), None},
+		{"short", []byte("MZ"), None},
+	}
+	for _, tt := range cases {
+		T.Run(tt.name, func(T *testing.T) {
+			if result := Detect(tt.data); result != tt.expected {
+				T.Errorf("Result: %d, expected: %d", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRandomRoundtrip(T *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, size := range []int{0, 1, 4, 5, 6, 17, 4096, 65537} {
+		b := make([]byte, size)
+		rnd.Read(b)
+		// plenty of call opcodes and branch instructions
+		for i := 0; i+16 <= size; i += 16 {
+			b[i] = 0xE8
+			binary.LittleEndian.PutUint32(b[i+8:], 0x94000000|uint32(i))
+			binary.LittleEndian.PutUint32(b[i+12:], 0x90000000|uint32(i))
+		}
+		roundtrip(T, X86, b)
+		roundtrip(T, ARM64, b)
+	}
+}
+
+func TestX86Calls(T *testing.T) {
+	// the same function is called from the different places
+	b := make([]byte, 64)
+	for i := 0; i < 4; i++ {
+		pos := i * 16
+		b[pos] = 0xE8
+		binary.LittleEndian.PutUint32(b[pos+1:], uint32(1000-pos-5))
+	}
+	encoded := roundtrip(T, X86, b)
+	for i := 1; i < 4; i++ {
+		if !bytes.Equal(encoded[1:5], encoded[i*16+1:i*16+5]) {
+			T.Errorf("Call %d is not converted to the absolute address", i)
+		}
+	}
+}
+
+func TestARM64Calls(T *testing.T) {
+	b := make([]byte, 64)
+	for i := 0; i < 4; i++ {
+		pos := i * 16
+		binary.LittleEndian.PutUint32(b[pos:], 0x94000000|uint32(1000-pos/4))
+	}
+	encoded := roundtrip(T, ARM64, b)
+	for i := 1; i < 4; i++ {
+		if !bytes.Equal(encoded[0:4], encoded[i*16:i*16+4]) {
+			T.Errorf("Call %d is not converted to the absolute address", i)
+		}
+	}
+}
+
+// TestSampleBinaries builds the sample program for several platforms
+// and checks detection and filters on the real executables.
+func TestSampleBinaries(T *testing.T) {
+	if testing.Short() {
+		T.Skip("sample binaries are not built in short mode")
+	}
+	gobin := filepath.Join(runtime.GOROOT(), "bin", "go")
+	if _, err := os.Stat(gobin); err != nil {
+		T.Skip("go tool is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "bcj")
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "main.go")
+	err = ioutil.WriteFile(source, []byte("package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"sample\") }\n"), 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	targets := []struct {
+		goos, goarch string
+		expected     uint8
+	}{
+		{"linux", "amd64", X86},
+		{"linux", "arm64", ARM64},
+		{"windows", "amd64", X86},
+		{"windows", "arm64", ARM64},
+		{"darwin", "amd64", X86},
+		{"darwin", "arm64", ARM64},
+	}
+	for _, tt := range targets {
+		T.Run(tt.goos+"/"+tt.goarch, func(T *testing.T) {
+			output := filepath.Join(dir, tt.goos+"_"+tt.goarch)
+			cmd := exec.Command(gobin, "build", "-o", output, source)
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "GOOS="+tt.goos, "GOARCH="+tt.goarch, "CGO_ENABLED=0", "GOFLAGS=")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				T.Skipf("Unable to build sample: %v\n%s", err, out)
+			}
+			data, err := ioutil.ReadFile(output)
+			if err != nil {
+				T.Fatal(err)
+			}
+			filter := Detect(data)
+			if filter != tt.expected {
+				T.Fatalf("Result: %d, expected: %d", filter, tt.expected)
+			}
+			encoded := roundtrip(T, filter, data)
+			if bytes.Equal(encoded, data) {
+				T.Error("Filter does not change the executable")
+			}
+		})
+	}
+}
@@ -0,0 +1,410 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package classfile is the reversible transform for java class files.
+
+All classes of the group are split into separate streams: class structure,
+UTF8 constants, bytecode and other attributes. Each stream is concatenated
+across all classes, so similar content of different classes is placed together
+and compressed better.
+
+Classes, which can not be parsed, are stored as is.
+*/
+package classfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	magic = 0xCAFEBABE
+
+	modeRaw   uint8 = 0
+	modeSplit uint8 = 1
+)
+
+// streams of the splitted classes
+const (
+	streamMeta = iota
+	streamUTF8
+	streamCode
+	streamAttr
+	streamRaw
+	streamCount
+)
+
+// constant pool tags
+const (
+	tagUtf8               = 1
+	tagInteger            = 3
+	tagFloat              = 4
+	tagLong               = 5
+	tagDouble             = 6
+	tagClass              = 7
+	tagString             = 8
+	tagFieldref           = 9
+	tagMethodref          = 10
+	tagInterfaceMethodref = 11
+	tagNameAndType        = 12
+	tagMethodHandle       = 15
+	tagMethodType         = 16
+	tagDynamic            = 17
+	tagInvokeDynamic      = 18
+	tagModule             = 19
+	tagPackage            = 20
+)
+
+var (
+	order = binary.BigEndian
+
+	errTruncated = errors.New("class data is truncated")
+)
+
+// IsClass check bytes for the java class file magic number.
+func IsClass(b []byte) bool {
+	return len(b) >= 4 && order.Uint32(b) == magic
+}
+
+// cursor moves bytes between the class file and the streams.
+type cursor interface {
+	take(stream int, n int) ([]byte, error)
+	moved() int
+}
+
+// splitter reads class file and appends its parts to the streams.
+type splitter struct {
+	class   []byte
+	pos     int
+	streams *[streamCount][]byte
+}
+
+func (s *splitter) take(stream int, n int) ([]byte, error) {
+	if n < 0 || s.pos+n > len(s.class) {
+		return nil, errTruncated
+	}
+	b := s.class[s.pos : s.pos+n]
+	s.pos += n
+	s.streams[stream] = append(s.streams[stream], b...)
+	return b, nil
+}
+
+func (s *splitter) moved() int {
+	return s.pos
+}
+
+// joiner reads the streams and restores class file.
+type joiner struct {
+	streams [streamCount][]byte
+	pos     [streamCount]int
+	class   []byte
+}
+
+func (j *joiner) take(stream int, n int) ([]byte, error) {
+	p := j.pos[stream]
+	if n < 0 || p+n > len(j.streams[stream]) {
+		return nil, errTruncated
+	}
+	b := j.streams[stream][p : p+n]
+	j.pos[stream] += n
+	j.class = append(j.class, b...)
+	return b, nil
+}
+
+func (j *joiner) moved() int {
+	return len(j.class)
+}
+
+func u1(c cursor) (int, error) {
+	b, err := c.take(streamMeta, 1)
+	if err != nil {
+		return 0, err
+	}
+	return int(b[0]), nil
+}
+
+func u2(c cursor) (int, error) {
+	b, err := c.take(streamMeta, 2)
+	if err != nil {
+		return 0, err
+	}
+	return int(order.Uint16(b)), nil
+}
+
+func u4(c cursor) (int, error) {
+	b, err := c.take(streamMeta, 4)
+	if err != nil {
+		return 0, err
+	}
+	v := order.Uint32(b)
+	if uint64(v) > uint64(int(^uint(0)>>1)) {
+		return 0, errTruncated
+	}
+	return int(v), nil
+}
+
+// walk is the class file parser. The same walk is used for split and join.
+func walk(c cursor) error {
+	// magic, minor and major versions
+	if _, err := c.take(streamMeta, 8); err != nil {
+		return err
+	}
+
+	count, err := u2(c)
+	if err != nil {
+		return err
+	}
+	names := make([]string, count)
+	for i := 1; i < count; i++ {
+		tag, err := u1(c)
+		if err != nil {
+			return err
+		}
+		size := 0
+		switch tag {
+		case tagUtf8:
+			l, err := u2(c)
+			if err != nil {
+				return err
+			}
+			b, err := c.take(streamUTF8, l)
+			if err != nil {
+				return err
+			}
+			names[i] = string(b)
+		case tagLong, tagDouble:
+			size = 8
+			i++ // takes two entries in the constant pool
+		case tagInteger, tagFloat, tagFieldref, tagMethodref, tagInterfaceMethodref,
+			tagNameAndType, tagDynamic, tagInvokeDynamic:
+			size = 4
+		case tagMethodHandle:
+			size = 3
+		case tagClass, tagString, tagMethodType, tagModule, tagPackage:
+			size = 2
+		default:
+			return fmt.Errorf("unknown constant pool tag %d", tag)
+		}
+		if size > 0 {
+			if _, err := c.take(streamMeta, size); err != nil {
+				return err
+			}
+		}
+	}
+
+	// access flags, this class and super class
+	if _, err := c.take(streamMeta, 6); err != nil {
+		return err
+	}
+	interfaces, err := u2(c)
+	if err != nil {
+		return err
+	}
+	if _, err := c.take(streamMeta, 2*interfaces); err != nil {
+		return err
+	}
+
+	// fields and methods
+	for m := 0; m < 2; m++ {
+		members, err := u2(c)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < members; i++ {
+			// access flags, name and descriptor
+			if _, err := c.take(streamMeta, 6); err != nil {
+				return err
+			}
+			if err := attributes(c, names); err != nil {
+				return err
+			}
+		}
+	}
+
+	return attributes(c, names)
+}
+
+func attributes(c cursor, names []string) error {
+	count, err := u2(c)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		name, err := u2(c)
+		if err != nil {
+			return err
+		}
+		length, err := u4(c)
+		if err != nil {
+			return err
+		}
+		if name < len(names) && names[name] == "Code" {
+			err = code(c, names, length)
+		} else {
+			_, err = c.take(streamAttr, length)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func code(c cursor, names []string, length int) error {
+	start := c.moved()
+
+	// max stack and max locals
+	if _, err := c.take(streamMeta, 4); err != nil {
+		return err
+	}
+	l, err := u4(c)
+	if err != nil {
+		return err
+	}
+	if _, err := c.take(streamCode, l); err != nil {
+		return err
+	}
+	exceptions, err := u2(c)
+	if err != nil {
+		return err
+	}
+	if _, err := c.take(streamMeta, 8*exceptions); err != nil {
+		return err
+	}
+	if err := attributes(c, names); err != nil {
+		return err
+	}
+
+	if c.moved()-start != length {
+		return errors.New("code attribute length mismatch")
+	}
+	return nil
+}
+
+func putUint32(b []byte, v int) []byte {
+	a := make([]byte, 4)
+	order.PutUint32(a, uint32(v))
+	return append(b, a...)
+}
+
+/*
+Encode will transform group of classes into the single byte array.
+*/
+func Encode(classes [][]byte) []byte {
+	var streams [streamCount][]byte
+	index := make([]byte, 0, 4+5*len(classes))
+	index = putUint32(index, len(classes))
+
+	for _, class := range classes {
+		var saved [streamCount]int
+		for i := range streams {
+			saved[i] = len(streams[i])
+		}
+
+		mode := modeSplit
+		s := splitter{class: class, streams: &streams}
+		if !IsClass(class) || walk(&s) != nil || s.pos != len(class) {
+			// rollback and keep the class unchanged
+			for i := range streams {
+				streams[i] = streams[i][:saved[i]]
+			}
+			streams[streamRaw] = append(streams[streamRaw], class...)
+			mode = modeRaw
+		}
+
+		index = append(index, mode)
+		index = putUint32(index, len(class))
+	}
+
+	for _, s := range streams {
+		index = putUint32(index, len(s))
+	}
+	for _, s := range streams {
+		index = append(index, s...)
+	}
+	return index
+}
+
+/*
+Decode will restore group of classes from the Encode result.
+*/
+func Decode(b []byte) ([][]byte, error) {
+	if len(b) < 4 {
+		return nil, errTruncated
+	}
+	count := int(order.Uint32(b))
+	pos := 4
+	if count > (len(b)-pos)/5 {
+		return nil, errTruncated
+	}
+
+	modes := make([]uint8, count)
+	sizes := make([]int, count)
+	for i := 0; i < count; i++ {
+		modes[i] = b[pos]
+		sizes[i] = int(order.Uint32(b[pos+1 : pos+5]))
+		pos += 5
+	}
+
+	if len(b)-pos < 4*streamCount {
+		return nil, errTruncated
+	}
+	j := joiner{}
+	lengths := b[pos : pos+4*streamCount]
+	pos += 4 * streamCount
+	for i := range j.streams {
+		l := int(order.Uint32(lengths[4*i:]))
+		if l > len(b)-pos {
+			return nil, errTruncated
+		}
+		j.streams[i] = b[pos : pos+l]
+		pos += l
+	}
+	if pos != len(b) {
+		return nil, errors.New("unexpected data after class streams")
+	}
+
+	classes := make([][]byte, count)
+	for i := 0; i < count; i++ {
+		if sizes[i] > len(b) {
+			return nil, errTruncated
+		}
+		j.class = make([]byte, 0, sizes[i])
+		switch modes[i] {
+		case modeRaw:
+			if _, err := j.take(streamRaw, sizes[i]); err != nil {
+				return nil, err
+			}
+		case modeSplit:
+			if err := walk(&j); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown class mode %d", modes[i])
+		}
+		if len(j.class) != sizes[i] {
+			return nil, fmt.Errorf("class %d size mismatch: %d, expected %d", i, len(j.class), sizes[i])
+		}
+		classes[i] = j.class
+	}
+
+	return classes, nil
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package classfile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const classesFolder = "../../../test/testdata/classfiles"
+
+func readClasses(T *testing.T) [][]byte {
+	names, err := filepath.Glob(filepath.Join(classesFolder, "*.class"))
+	if err != nil {
+		T.Fatal(err)
+	}
+	if len(names) == 0 {
+		T.Fatal("No test classes found")
+	}
+	classes := make([][]byte, 0, len(names))
+	for _, name := range names {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			T.Fatal(err)
+		}
+		classes = append(classes, b)
+	}
+	return classes
+}
+
+func TestIsClass(T *testing.T) {
+	if !IsClass([]byte{0xCA, 0xFE, 0xBA, 0xBE, 0}) {
+		T.Error("Class magic is not detected")
+	}
+	if IsClass([]byte{0xCA, 0xFE, 0xBA}) {
+		T.Error("Short data detected as class")
+	}
+	if IsClass([]byte("PK\x03\x04")) {
+		T.Error("Zip data detected as class")
+	}
+}
+
+func TestSplitClass(T *testing.T) {
+	for _, class := range readClasses(T) {
+		var streams [streamCount][]byte
+		s := splitter{class: class, streams: &streams}
+		err := walk(&s)
+		if err != nil {
+			T.Fatal(err)
+		}
+		if s.pos != len(class) {
+			T.Errorf("Class is not parsed to the end: %d of %d", s.pos, len(class))
+		}
+		for _, stream := range []int{streamMeta, streamUTF8, streamCode, streamAttr} {
+			if len(streams[stream]) == 0 {
+				T.Errorf("Stream %d is empty", stream)
+			}
+		}
+		if !bytes.Contains(streams[streamUTF8], []byte("java/lang/Object")) {
+			T.Error("UTF8 constants are not in the utf8 stream")
+		}
+	}
+}
+
+func TestEncodeDecode(T *testing.T) {
+	classes := readClasses(T)
+
+	broken := append([]byte(nil), classes[0][:len(classes[0])/2]...)
+	trailing := append(append([]byte(nil), classes[0]...), 1, 2, 3)
+	classes = append(classes, broken, trailing, []byte("not a class"), []byte{})
+
+	encoded := Encode(classes)
+	decoded, err := Decode(encoded)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if len(decoded) != len(classes) {
+		T.Fatalf("Unexpected number of classes %d, expected %d", len(decoded), len(classes))
+	}
+	for i := range classes {
+		if !bytes.Equal(classes[i], decoded[i]) {
+			T.Errorf("Class %d is not restored", i)
+		}
+	}
+}
+
+func TestDecodeBroken(T *testing.T) {
+	encoded := Encode(readClasses(T))
+	for _, l := range []int{0, 3, 10, len(encoded) / 2, len(encoded) - 1} {
+		_, err := Decode(encoded[:l])
+		if err == nil {
+			T.Errorf("Truncated data of %d bytes accepted", l)
+		}
+	}
+}
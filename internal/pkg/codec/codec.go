@@ -0,0 +1,115 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package codec is the set of compressors for the archive data segments.
+*/
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/internal/pkg/lzma"
+)
+
+// storeWriter is the writer without compression
+type storeWriter struct {
+	io.Writer
+}
+
+func (w storeWriter) Close() error {
+	return nil
+}
+
+// Name will return the name of the codec
+func Name(codec uint8) string {
+	switch codec {
+	case common.CodecStore:
+		return "store"
+	case common.CodecLZMA:
+		return "lzma"
+	case common.CodecDeflateDict:
+		return "deflate+dict"
+	case common.CodecDeflate:
+		return "deflate"
+	}
+	return fmt.Sprintf("codec%d", codec)
+}
+
+// NewWriter will create compressing writer of the given codec.
+// Dictionary is used by the dictionary-assisted codecs only.
+func NewWriter(codec uint8, w io.Writer, dict []byte) (io.WriteCloser, error) {
+	switch codec {
+	case common.CodecStore:
+		return storeWriter{w}, nil
+
+	case common.CodecLZMA:
+		return lzma.NewWriterLevel(w, 8), nil
+
+	case common.CodecDeflateDict:
+		return flate.NewWriterDict(w, flate.BestCompression, dict)
+
+	case common.CodecDeflate:
+		return flate.NewWriter(w, flate.BestCompression)
+	}
+	return nil, fmt.Errorf("Unsupported codec %d", codec)
+}
+
+// NewReader will create decompressing reader of the given codec.
+// Dictionary is used by the dictionary-assisted codecs only.
+func NewReader(codec uint8, r io.Reader, dict []byte) (io.ReadCloser, error) {
+	switch codec {
+	case common.CodecStore:
+		return ioutil.NopCloser(r), nil
+
+	case common.CodecLZMA:
+		return lzma.NewReader(r), nil
+
+	case common.CodecDeflateDict:
+		return flate.NewReaderDict(r, dict), nil
+
+	case common.CodecDeflate:
+		return flate.NewReader(r), nil
+	}
+	return nil, fmt.Errorf("Unsupported codec %d", codec)
+}
+
+// Encode will compress the data with the given codec.
+func Encode(codec uint8, data []byte, dict []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, err := NewWriter(codec, &b, dict)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
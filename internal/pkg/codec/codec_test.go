@@ -0,0 +1,102 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package codec
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+func compress(T *testing.T, codecID uint8, data []byte, dict []byte) []byte {
+	var b bytes.Buffer
+	w, err := NewWriter(codecID, &b, dict)
+	if err != nil {
+		T.Fatal(err)
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		T.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		T.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func decompress(T *testing.T, codecID uint8, data []byte, dict []byte) []byte {
+	r, err := NewReader(codecID, bytes.NewReader(data), dict)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		T.Fatal(err)
+	}
+	return b
+}
+
+func TestCodecs(T *testing.T) {
+	data := bytes.Repeat([]byte("java.version=1.8.0_172\n"), 100)
+	dict := []byte("java.version=")
+	for _, codecID := range []uint8{common.CodecLZMA, common.CodecDeflateDict, common.CodecDeflate} {
+		compressed := compress(T, codecID, data, dict)
+		encoded, err := Encode(codecID, data, dict)
+		if err != nil {
+			T.Fatal(err)
+		}
+		if !bytes.Equal(compressed, encoded) {
+			T.Errorf("Codec %d encoded data differs from the writer output", codecID)
+		}
+		if len(compressed) >= len(data) {
+			T.Errorf("Codec %d does not compress: %d bytes", codecID, len(compressed))
+		}
+		result := decompress(T, codecID, compressed, dict)
+		if !bytes.Equal(data, result) {
+			T.Errorf("Codec %d is not reversible", codecID)
+		}
+	}
+}
+
+func TestStore(T *testing.T) {
+	data := []byte("some stored data")
+	stored := compress(T, common.CodecStore, data, nil)
+	if !bytes.Equal(data, stored) {
+		T.Error("Stored data is changed")
+	}
+	if !bytes.Equal(data, decompress(T, common.CodecStore, stored, nil)) {
+		T.Error("Stored data is not restored")
+	}
+}
+
+func TestUnsupportedCodec(T *testing.T) {
+	_, err := NewWriter(200, &bytes.Buffer{}, nil)
+	if err == nil {
+		T.Error("Unsupported codec writer created")
+	}
+	_, err = NewReader(200, &bytes.Buffer{}, nil)
+	if err == nil {
+		T.Error("Unsupported codec reader created")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package codec
+
+import (
+	"container/heap"
+	"encoding/binary"
+)
+
+const (
+	// DictionarySize is the maximal dictionary size, used by deflate window
+	DictionarySize = 32 * 1024
+
+	kmerSize    = 8
+	segmentSize = 64
+)
+
+// candidate is the part of the sample, which can be placed into dictionary
+type candidate struct {
+	data  []byte
+	score int
+}
+
+type candidates []*candidate
+
+func (c candidates) Len() int            { return len(c) }
+func (c candidates) Less(i, j int) bool  { return c[i].score > c[j].score }
+func (c candidates) Swap(i, j int)       { c[i], c[j] = c[j], c[i] }
+func (c *candidates) Push(x interface{}) { *c = append(*c, x.(*candidate)) }
+func (c *candidates) Pop() interface{} {
+	old := *c
+	n := len(old)
+	x := old[n-1]
+	*c = old[:n-1]
+	return x
+}
+
+/*
+Train will build dictionary of the given size from the samples.
+
+Every sample is cut into the small segments. The segment score is the sum of
+the frequencies of its 8-byte substrings, where frequency is the number of the
+samples with this substring. Best segments are taken greedy, and substrings of
+the taken segment are not counted anymore.
+*/
+func Train(samples [][]byte, size int) []byte {
+	freq := make(map[uint64]int)
+	for _, s := range samples {
+		seen := make(map[uint64]bool)
+		for i := 0; i+kmerSize <= len(s); i++ {
+			k := binary.LittleEndian.Uint64(s[i:])
+			if !seen[k] {
+				seen[k] = true
+				freq[k]++
+			}
+		}
+	}
+
+	score := func(b []byte) int {
+		result := 0
+		for i := 0; i+kmerSize <= len(b); i++ {
+			if f := freq[binary.LittleEndian.Uint64(b[i:])]; f > 1 {
+				result += f
+			}
+		}
+		return result
+	}
+
+	h := make(candidates, 0)
+	for _, s := range samples {
+		for i := 0; i+kmerSize <= len(s); i += segmentSize {
+			end := i + segmentSize
+			if end > len(s) {
+				end = len(s)
+			}
+			c := &candidate{data: s[i:end]}
+			c.score = score(c.data)
+			if c.score > 0 {
+				h = append(h, c)
+			}
+		}
+	}
+	heap.Init(&h)
+
+	picked := make([][]byte, 0)
+	total := 0
+	for h.Len() > 0 && total < size {
+		c := heap.Pop(&h).(*candidate)
+		s := score(c.data)
+		if s == 0 {
+			continue
+		}
+		if s < c.score && h.Len() > 0 && s < h[0].score {
+			// score is changed by the already taken segments
+			c.score = s
+			heap.Push(&h, c)
+			continue
+		}
+
+		picked = append(picked, c.data)
+		total += len(c.data)
+		for i := 0; i+kmerSize <= len(c.data); i++ {
+			delete(freq, binary.LittleEndian.Uint64(c.data[i:]))
+		}
+	}
+
+	// the best segments are placed at the end, nearest to the compressed data
+	dict := make([]byte, 0, total)
+	for i := len(picked) - 1; i >= 0; i-- {
+		dict = append(dict, picked[i]...)
+	}
+	if len(dict) > size {
+		dict = dict[len(dict)-size:]
+	}
+	return dict
+}
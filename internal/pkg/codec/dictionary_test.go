@@ -0,0 +1,79 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+// properties is the sample of the small similar resources
+func properties(n int) [][]byte {
+	samples := make([][]byte, n)
+	for i := range samples {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "# Copyright (c) 2018, Oracle and/or its affiliates. All rights reserved.\n")
+		fmt.Fprintf(&b, "# ORACLE PROPRIETARY/CONFIDENTIAL. Use is subject to license terms.\n")
+		fmt.Fprintf(&b, "sun.security.provider.%d.name=Provider%d\n", i, i*7)
+		fmt.Fprintf(&b, "sun.security.provider.%d.class=sun.security.provider.Sun%d\n", i, i*13)
+		samples[i] = b.Bytes()
+	}
+	return samples
+}
+
+func TestTrain(T *testing.T) {
+	samples := properties(100)
+	dict := Train(samples, 1024)
+	if len(dict) == 0 {
+		T.Fatal("Empty dictionary")
+	}
+	if len(dict) > 1024 {
+		T.Errorf("Dictionary is too big: %d", len(dict))
+	}
+	if !bytes.Contains(dict, []byte("affiliates")) {
+		T.Error("Dictionary does not contain the common text")
+	}
+
+	withDict := 0
+	withoutDict := 0
+	for _, s := range properties(10) {
+		withDict += len(compress(T, common.CodecDeflateDict, s, dict))
+		withoutDict += len(compress(T, common.CodecDeflateDict, s, nil))
+		if !bytes.Equal(s, decompress(T, common.CodecDeflateDict, compress(T, common.CodecDeflateDict, s, dict), dict)) {
+			T.Error("Sample is not restored")
+		}
+	}
+	T.Logf("Compressed with dictionary: %d, without: %d", withDict, withoutDict)
+	if withDict >= withoutDict {
+		T.Error("Dictionary does not improve compression")
+	}
+}
+
+func TestTrainEmpty(T *testing.T) {
+	if dict := Train(nil, DictionarySize); len(dict) != 0 {
+		T.Errorf("Dictionary from nothing: %v", dict)
+	}
+	if dict := Train([][]byte{[]byte("unique")}, DictionarySize); len(dict) != 0 {
+		T.Errorf("Dictionary from unique sample: %v", dict)
+	}
+}
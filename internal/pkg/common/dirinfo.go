@@ -20,17 +20,18 @@
 package common
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"os"
 	"path"
 	"strconv"
 	"strings"
-
-	"github.com/alexript/jrepack/ui"
 )
 
 // File is the representation of the file entity.
@@ -63,6 +64,9 @@ const (
 // Offset is the file hashes by 4 bytes of file offset in _uncompressed_ data array.
 type Offset map[uint32][]byte
 
+// Filters is the data filters by 4 bytes of file offset in _uncompressed_ data array.
+type Filters map[uint32]uint8
+
 // Dirinfo is the hash to files map, used as basic structure for output file header.
 type Dirinfo map[string][]*File
 
@@ -85,8 +89,6 @@ var (
 	zip            = ContainerType{Name: "zip file", Extension: zipExt}
 	jar            = ContainerType{Name: "jar file", Extension: jarExt}
 	containerTypes = []ContainerType{zip, jar}
-	dirinfo        = make(Dirinfo)
-	offsets        = make(Offset)
 )
 
 // IsContainer check file name for .zip or .jar extensions
@@ -101,67 +103,83 @@ func IsContainer(filename string) (*ContainerType, bool) {
 	return nil, false
 }
 
-// ClearDirinfo is for Dirinfo and Offset maps reset.
-func ClearDirinfo() {
-	dirinfo = make(Dirinfo)
-	offsets = make(Offset)
-}
-
-// GetDirinfo will return current state of the DirInfo object
-func GetDirinfo() *Dirinfo {
-	return &dirinfo
+// Catalog is the state of one packing: files by hash summ, hashes by data
+// offset and filters of the data records.
+type Catalog struct {
+	Dirinfo Dirinfo
+	Offsets Offset
+	Filters Filters
 }
 
-// GetOffsets will return current state of the Offsets object
-func GetOffsets() *Offset {
-	return &offsets
-}
-
-// SetOffset apply hash to the data offset value.
-func SetOffset(offset uint32, hash []byte) {
-	offsets[offset] = hash
+// NewCatalog will create empty catalog for the new packing
+func NewCatalog() *Catalog {
+	return &Catalog{
+		Dirinfo: make(Dirinfo),
+		Offsets: make(Offset),
+		Filters: make(Filters),
+	}
 }
 
-func addFileToDirinfo(f *File) bool {
+// AddFile will add file into Dirinfo, true is returned for the first file
+// with this hash summ.
+func (c *Catalog) AddFile(f *File) bool {
 	key := hex.EncodeToString(f.Hashsum)
 
 	isNewHash := false
 
-	if _, ok := dirinfo[key]; !ok {
-		dirinfo[key] = make([]*File, 0)
+	if _, ok := c.Dirinfo[key]; !ok {
+		c.Dirinfo[key] = make([]*File, 0)
 		isNewHash = true
 	}
-	dirinfo[key] = append(dirinfo[key], f)
+	c.Dirinfo[key] = append(c.Dirinfo[key], f)
 	return isNewHash
 }
 
-// NewFile will create new File object
-func NewFile(filename string, body []byte) (*File, bool) {
-	l := len(body)
-	bs := []byte(strconv.Itoa(l))
+// SetOffset apply hash to the data offset value.
+func (c *Catalog) SetOffset(offset uint32, hash []byte) {
+	c.Offsets[offset] = hash
+}
 
-	h := sha256.New()
-	h.Reset()
-	h.Write(bs) // hash is not just sha256 of file, but sha256 of file size _and_ file data
-	h.Write(body)
+// SetFilter apply filter to the data offset value.
+func (c *Catalog) SetFilter(offset uint32, filter uint8) {
+	c.Filters[offset] = filter
+}
 
-	hs := h.Sum(nil)
-	f := File{
-		Name:    filename,
-		Size:    l,
-		Hashsum: hs,
-	}
+// Hash will calculate hash summ of the file body.
+func Hash(body []byte) []byte {
+	h, _ := HashReader(bytes.NewReader(body), int64(len(body)))
+	return h
+}
 
-	isNewHash := addFileToDirinfo(&f)
+// NewHash will create hash of the file body of the given size, the body is
+// written into it
+func NewHash(size int64) hash.Hash {
+	h := sha256.New()
+	h.Write([]byte(strconv.FormatInt(size, 10))) // hash is not just sha256 of file, but sha256 of file size _and_ file data
+	return h
+}
 
-	ui.Current().Hashed(ui.Hash{
-		File:      filename,
-		Size:      l,
-		Hash:      hs,
-		IsNewHash: isNewHash,
-	})
+// HashReader will calculate hash summ of the file body of the given size, read
+// from r. Body of the other size is the error.
+func HashReader(r io.Reader, size int64) ([]byte, error) {
+	h := NewHash(size)
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+	if n != size {
+		return nil, fmt.Errorf("Size changed while reading: %d bytes, expected %d bytes", n, size)
+	}
+	return h.Sum(nil), nil
+}
 
-	return &f, isNewHash
+// NewFile will create new File object
+func NewFile(filename string, body []byte) *File {
+	return &File{
+		Name:    filename,
+		Size:    len(body),
+		Hashsum: Hash(body),
+	}
 }
 
 // NewFolder will create new Folder object.
@@ -175,11 +193,6 @@ func NewFolder(foldername string, isContainer bool) Folder {
 
 	fname := foldername[0 : i+1]
 
-	ui.Current().NewFolder(ui.Folder{
-		IsContainer: isContainer,
-		Name:        fname,
-	})
-
 	return Folder{
 		IsContainer: isContainer,
 		Name:        fname,
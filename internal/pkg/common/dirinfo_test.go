@@ -20,6 +20,7 @@
 package common
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"path"
@@ -89,7 +90,7 @@ func TestNewFile(t *testing.T) {
 	expectedBody := fromHex(expectedHexString)
 	expectedLength := len(expectedBody)
 	expectedHash := "55b88037ec60704aa5dc318200f6998afb24b31d1a7b1d3f5d2263472ea73f70"
-	f, _ := NewFile(expectedName, expectedBody)
+	f := NewFile(expectedName, expectedBody)
 	if expectedName != f.Name {
 		t.Errorf("Result: '%v', expected: '%v'", f.Name, expectedName)
 	}
@@ -102,6 +103,22 @@ func TestNewFile(t *testing.T) {
 	}
 }
 
+func TestHashReader(t *testing.T) {
+	body := fromHex("010203040506")
+	expectedHash := "55b88037ec60704aa5dc318200f6998afb24b31d1a7b1d3f5d2263472ea73f70"
+	h, err := HashReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toHex(h) != expectedHash {
+		t.Errorf("Result: '%v', expected: '%v'", toHex(h), expectedHash)
+	}
+	_, err = HashReader(bytes.NewReader(body), int64(len(body))+1)
+	if err == nil {
+		t.Error("Truncated body accepted")
+	}
+}
+
 func TestNewFolder(t *testing.T) {
 	expectedName := "test"
 	expectedZeroNum := 0
@@ -128,7 +145,7 @@ func TestAddFileToFolder(t *testing.T) {
 		t.Error("Nil folder and Nil file are accepted")
 	}
 
-	f, _ := NewFile("test", expectedBody)
+	f := NewFile("test", expectedBody)
 	err = AddFileToFolder(nil, f)
 	if err == nil {
 		t.Error("Nil folder are accepted")
@@ -208,43 +225,48 @@ func TestAddFileToDirinfo(t *testing.T) {
 	// dummy folder to collect files
 	fold := NewFolder("dummy", false)
 
-	ClearDirinfo()
-	currentLen := len(dirinfo)
+	c := NewCatalog()
+	currentLen := len(c.Dirinfo)
 	if currentLen > 0 {
-		t.Error("Unable to cleanup the dirinfo")
+		t.Error("New catalog is not empty")
 	}
 
-	f1, isNewHash1 := NewFile(expectedName1, expectedBody1)
+	f1 := NewFile(expectedName1, expectedBody1)
+	isNewHash1 := c.AddFile(f1)
 	AddFileToFolder(&fold, f1)
-	currentLen = len(dirinfo)
+	currentLen = len(c.Dirinfo)
 	if currentLen != 1 || !isNewHash1 {
 		t.Error("Unable to add file into empty dirinfo")
 	}
 
-	f2, isNewHash2 := NewFile(expectedName1, expectedBody1)
+	f2 := NewFile(expectedName1, expectedBody1)
+	isNewHash2 := c.AddFile(f2)
 	AddFileToFolder(&fold, f2)
-	currentLen = len(dirinfo)
+	currentLen = len(c.Dirinfo)
 	if currentLen != 1 || isNewHash2 {
 		t.Error("Different key is produced for the same file")
 	}
 
-	f3, isNewHash3 := NewFile(expectedName2, expectedBody2)
+	f3 := NewFile(expectedName2, expectedBody2)
+	isNewHash3 := c.AddFile(f3)
 	AddFileToFolder(&fold, f3)
-	currentLen = len(dirinfo)
+	currentLen = len(c.Dirinfo)
 	if currentLen != 1 || isNewHash3 {
 		t.Error("Same file content but different name failed")
 	}
 
-	f4, isNewHash4 := NewFile(expectedName3, expectedBody3)
+	f4 := NewFile(expectedName3, expectedBody3)
+	isNewHash4 := c.AddFile(f4)
 	AddFileToFolder(&fold, f4)
-	currentLen = len(dirinfo)
+	currentLen = len(c.Dirinfo)
 	if currentLen != 2 || !isNewHash4 {
 		t.Error("Different content not separated")
 	}
 
-	f5, isNewHash5 := NewFile(expectedName4, expectedBody4)
+	f5 := NewFile(expectedName4, expectedBody4)
+	isNewHash5 := c.AddFile(f5)
 	AddFileToFolder(&fold, f5)
-	currentLen = len(dirinfo)
+	currentLen = len(c.Dirinfo)
 	if currentLen != 3 || !isNewHash5 {
 		t.Error("Totally different file not separated")
 	}
@@ -335,7 +357,7 @@ func TestAddFoldersAndFilesToFolder(T *testing.T) {
 	hexString := "010203040506"
 	body := fromHex(hexString)
 	parent := NewFolder("test", false)
-	file, _ := NewFile(testCase, body)
+	file := NewFile(testCase, body)
 	AddFileToFolder(&parent, file)
 
 	level1 := parent.Folders
@@ -373,7 +395,7 @@ func TestAddContainerToFolder(T *testing.T) {
 	s2 := "/F/test"
 	zip := NewFolder("zip", true)
 	folder := NewFolder(s1, false)
-	file, _ := NewFile(s2, expectedBody)
+	file := NewFile(s2, expectedBody)
 	AddFolderToFolder(&zip, &folder)
 	AddFileToFolder(&zip, file)
 
@@ -390,3 +412,14 @@ func TestAddContainerToFolder(T *testing.T) {
 	log("Dirname: %s, Basename: %s", dirname, basename)
 	log("Struct: %v", zip)
 }
+
+func TestHash(T *testing.T) {
+	body := []byte("hash me")
+	f := NewFile("hashed", body)
+	if hex.EncodeToString(Hash(body)) != hex.EncodeToString(f.Hashsum) {
+		T.Errorf("Unexpected hash %x, expected %x", Hash(body), f.Hashsum)
+	}
+	if hex.EncodeToString(Hash(nil)) == hex.EncodeToString(Hash([]byte{0})) {
+		T.Error("Hash does not depend on size")
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// KDFScrypt is the scrypt key derivation of the archive key
+	KDFScrypt uint8 = 1
+
+	// CipherAESGCM is AES-256 in GCM mode
+	CipherAESGCM uint8 = 1
+
+	// HeaderStream is the stream number of the encrypted header.
+	// Data segments are encrypted as the streams with the segment index.
+	HeaderStream uint32 = 0xFFFFFFFF
+
+	// DefaultScryptLogN is the binary logarithm of the scrypt cost parameter N
+	DefaultScryptLogN = 15
+
+	keySize        = 32
+	saltSize       = 16
+	encryptionSize = 11 + saltSize
+	recordSize     = 64 * 1024
+
+	// maxScryptMemory is the limit of the memory, required by the key derivation
+	maxScryptMemory = 1 << 30
+)
+
+var (
+	// ErrEncrypted is the error for the encrypted archive, opened without password
+	ErrEncrypted = errors.New("Archive is encrypted, password is required")
+
+	// ErrPassword is the error for the wrong password of the encrypted archive
+	ErrPassword = errors.New("Wrong password")
+)
+
+// Encryption is the set of the key derivation parameters of the encrypted archive.
+// It is stored in the trailer.
+type Encryption struct {
+	KDF    uint8  `json:"kdf"`
+	Cipher uint8  `json:"cipher"`
+	LogN   uint8  `json:"logn"`
+	R      uint32 `json:"r"`
+	P      uint32 `json:"p"`
+	Salt   []byte `json:"salt"`
+}
+
+// NewEncryption will create encryption parameters with the random salt
+func NewEncryption() (*Encryption, error) {
+	salt := make([]byte, saltSize)
+	_, err := io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to generate salt: %v", err)
+	}
+	return &Encryption{
+		KDF:    KDFScrypt,
+		Cipher: CipherAESGCM,
+		LogN:   DefaultScryptLogN,
+		R:      8,
+		P:      1,
+		Salt:   salt,
+	}, nil
+}
+
+// ToBinary will transform encryption parameters into bytearray
+func (e *Encryption) ToBinary() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(e.KDF)
+	buf.WriteByte(e.Cipher)
+	buf.WriteByte(e.LogN)
+	binary.Write(buf, Order, e.R)
+	binary.Write(buf, Order, e.P)
+	buf.Write(e.Salt)
+	return buf.Bytes()
+}
+
+// encryptionFromBinary will read and check encryption parameters
+func encryptionFromBinary(b []byte) (*Encryption, error) {
+	if len(b) != encryptionSize {
+		return nil, fmt.Errorf("%w: invalid encryption parameters size %d", ErrCorrupted, len(b))
+	}
+	e := &Encryption{
+		KDF:    b[0],
+		Cipher: b[1],
+		LogN:   b[2],
+		R:      Order.Uint32(b[3:7]),
+		P:      Order.Uint32(b[7:11]),
+		Salt:   b[11:],
+	}
+	if e.KDF != KDFScrypt || e.Cipher != CipherAESGCM {
+		return nil, fmt.Errorf("Unsupported encryption: kdf %d, cipher %d", e.KDF, e.Cipher)
+	}
+	// hostile parameters must not exhaust the memory or CPU, memory is 128*r*N
+	if e.LogN < 1 || e.LogN > 30 || e.R < 1 || e.P < 1 || e.P > 16 ||
+		e.R > maxScryptMemory>>(7+e.LogN) {
+		return nil, fmt.Errorf("%w: invalid scrypt parameters N=2^%d, r=%d, p=%d", ErrCorrupted, e.LogN, e.R, e.P)
+	}
+	return e, nil
+}
+
+// Key will derive the archive key from the password
+func (e *Encryption) Key(password string) (*Key, error) {
+	if password == "" {
+		return nil, ErrEncrypted
+	}
+	key, err := e.derive(password)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{aead: aead}, nil
+}
+
+// derive will derive the key bytes from the password by scrypt
+func (e *Encryption) derive(password string) ([]byte, error) {
+	return scrypt.Key([]byte(password), e.Salt, 1<<e.LogN, int(e.R), int(e.P), keySize)
+}
+
+/*
+Key is the key of the encrypted archive.
+
+Header and every data segment are encrypted as the independent streams. Stream
+is split into the records of 64KiB, each record is sealed with the nonce of the
+stream number, record number and the flag of the last record. So the records can
+not be reordered, moved into another stream or truncated.
+*/
+type Key struct {
+	aead cipher.AEAD
+}
+
+func (k *Key) nonce(stream uint32, record uint32, last bool) []byte {
+	nonce := make([]byte, k.aead.NonceSize())
+	Order.PutUint32(nonce[0:4], stream)
+	Order.PutUint32(nonce[4:8], record)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// Seal will encrypt the whole stream
+func (k *Key) Seal(stream uint32, b []byte) []byte {
+	var buf bytes.Buffer
+	w := k.Writer(&buf, stream)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+// Open will decrypt the whole stream
+func (k *Key) Open(stream uint32, b []byte) ([]byte, error) {
+	return ioutil.ReadAll(k.Reader(bytes.NewReader(b), stream))
+}
+
+// Writer will create encrypting writer of the stream. Close will write the
+// last record, underlying writer is not closed.
+func (k *Key) Writer(w io.Writer, stream uint32) io.WriteCloser {
+	return &sealWriter{
+		key:    k,
+		w:      w,
+		stream: stream,
+		buf:    make([]byte, 0, recordSize),
+	}
+}
+
+// Reader will create decrypting reader of the stream. Damaged, truncated or
+// extended stream is reported by ErrCorrupted.
+func (k *Key) Reader(r io.Reader, stream uint32) io.Reader {
+	return &openReader{
+		key:    k,
+		r:      bufio.NewReader(r),
+		stream: stream,
+	}
+}
+
+type sealWriter struct {
+	key    *Key
+	w      io.Writer
+	stream uint32
+	record uint32
+	buf    []byte
+}
+
+func (s *sealWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// full record is written, when there is more data, the last one is written on close
+		if len(s.buf) == recordSize {
+			err := s.flush(false)
+			if err != nil {
+				return n, err
+			}
+		}
+		l := recordSize - len(s.buf)
+		if l > len(p) {
+			l = len(p)
+		}
+		s.buf = append(s.buf, p[:l]...)
+		p = p[l:]
+		n += l
+	}
+	return n, nil
+}
+
+func (s *sealWriter) flush(last bool) error {
+	sealed := s.key.aead.Seal(nil, s.key.nonce(s.stream, s.record, last), s.buf, nil)
+	s.record++
+	s.buf = s.buf[:0]
+	_, err := s.w.Write(sealed)
+	return err
+}
+
+func (s *sealWriter) Close() error {
+	return s.flush(true)
+}
+
+type openReader struct {
+	key    *Key
+	r      *bufio.Reader
+	stream uint32
+	record uint32
+	buf    []byte
+	plain  []byte
+	done   bool
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for len(o.plain) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+		err := o.next()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, o.plain)
+	o.plain = o.plain[n:]
+	return n, nil
+}
+
+// next will read and decrypt the next record
+func (o *openReader) next() error {
+	if o.buf == nil {
+		o.buf = make([]byte, recordSize+o.key.aead.Overhead())
+	}
+	n, err := io.ReadFull(o.r, o.buf)
+	last := false
+	switch err {
+	case nil:
+		// full record is the last one at the end of the stream
+		_, err = o.r.Peek(1)
+		last = err == io.EOF
+	case io.ErrUnexpectedEOF, io.EOF:
+		last = true
+	default:
+		return err
+	}
+
+	plain, err := o.key.aead.Open(o.buf[:0], o.key.nonce(o.stream, o.record, last), o.buf[:n], nil)
+	if err != nil {
+		return fmt.Errorf("%w: encrypted record %d of stream %d is damaged", ErrCorrupted, o.record, o.stream)
+	}
+	o.record++
+	o.plain = plain
+	o.done = last
+	return nil
+}
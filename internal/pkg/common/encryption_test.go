@@ -0,0 +1,197 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestScrypt(T *testing.T) {
+	// test vectors of RFC 7914, the key is the first 32 bytes
+	cases := []struct {
+		password, salt string
+		logN           uint8
+		r, p           uint32
+		expected       string
+	}{
+		{"", "", 4, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442"},
+		{"password", "NaCl", 10, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b373162"},
+		{"pleaseletmein", "SodiumChloride", 14, 8, 1, "7023bdcb3afd7348461c06cd81fd38ebfda8fbba904f8e3ea9b543f6545da1f2"},
+	}
+	for _, c := range cases {
+		e := &Encryption{KDF: KDFScrypt, Cipher: CipherAESGCM, LogN: c.logN, R: c.r, P: c.p, Salt: []byte(c.salt)}
+		key, err := e.derive(c.password)
+		if err != nil {
+			T.Fatal(err)
+		}
+		if hex.EncodeToString(key) != c.expected {
+			T.Errorf("Unexpected key for %q: %x", c.password, key)
+		}
+	}
+}
+
+func testKey(T *testing.T, password string) (*Encryption, *Key) {
+	e, err := NewEncryption()
+	if err != nil {
+		T.Fatal(err)
+	}
+	// fast key derivation for tests
+	e.LogN = 10
+	key, err := e.Key(password)
+	if err != nil {
+		T.Fatal(err)
+	}
+	return e, key
+}
+
+func TestEncryptionStream(T *testing.T) {
+	_, key := testKey(T, "secret")
+
+	for _, size := range []int{0, 1, recordSize - 1, recordSize, recordSize + 1, 3 * recordSize} {
+		data := bytes.Repeat([]byte("jrepack"), size/7+1)[:size]
+		sealed := key.Seal(1, data)
+		if bytes.Contains(sealed, []byte("jrepack")) {
+			T.Errorf("Plain data in the stream of %d bytes", size)
+		}
+
+		opened, err := key.Open(1, sealed)
+		if err != nil {
+			T.Errorf("Unable to open stream of %d bytes: %v", size, err)
+		} else if !bytes.Equal(opened, data) {
+			T.Errorf("Unexpected data of the stream of %d bytes", size)
+		}
+
+		// small reads of the streaming reader
+		r := key.Reader(bytes.NewReader(sealed), 1)
+		var b bytes.Buffer
+		p := make([]byte, 1000)
+		for {
+			n, err := r.Read(p)
+			b.Write(p[:n])
+			if err != nil {
+				break
+			}
+		}
+		if !bytes.Equal(b.Bytes(), data) {
+			T.Errorf("Unexpected streamed data of %d bytes", size)
+		}
+	}
+}
+
+func TestEncryptionDamaged(T *testing.T) {
+	_, key := testKey(T, "secret")
+	data := bytes.Repeat([]byte{1, 2, 3}, recordSize)
+	sealed := key.Seal(1, data)
+	record := recordSize + 16
+
+	damaged := append([]byte(nil), sealed...)
+	damaged[100] ^= 1
+	reordered := append(append(append([]byte(nil), sealed[record:2*record]...), sealed[:record]...), sealed[2*record:]...)
+
+	cases := map[string][]byte{
+		"damaged":   damaged,
+		"truncated": sealed[:2*record],
+		"cut":       sealed[:len(sealed)-1],
+		"extended":  append(append([]byte(nil), sealed...), 0),
+		"reordered": reordered,
+		"empty":     {},
+	}
+	for name, c := range cases {
+		_, err := ioutil.ReadAll(key.Reader(bytes.NewReader(c), 1))
+		if !errors.Is(err, ErrCorrupted) {
+			T.Errorf("%s stream accepted: %v", name, err)
+		}
+	}
+
+	if _, err := key.Open(2, sealed); !errors.Is(err, ErrCorrupted) {
+		T.Errorf("Stream of another number accepted: %v", err)
+	}
+
+	e, _ := testKey(T, "secret")
+	other, err := e.Key("other")
+	if err != nil {
+		T.Fatal(err)
+	}
+	if _, err := other.Open(1, sealed); !errors.Is(err, ErrCorrupted) {
+		T.Errorf("Wrong key accepted: %v", err)
+	}
+	if _, err := e.Key(""); !errors.Is(err, ErrEncrypted) {
+		T.Errorf("Empty password accepted: %v", err)
+	}
+}
+
+func TestEncryptedTrailer(T *testing.T) {
+	header := []byte("header")
+	data := []byte("some data and header")
+	trailer := NewTrailer(uint32(len(data)), header)
+	e, _ := testKey(T, "secret")
+	trailer.Encrypt(e)
+	data = append(data, header...)
+	data = append(data, trailer.ToBinary()...)
+
+	t, err := ReadTrailer(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		T.Fatal(err)
+	}
+	if t.Version != FormatVersionEncrypted || t.Encryption == nil {
+		T.Fatalf("Unexpected trailer %v", t)
+	}
+	if !bytes.Equal(t.Encryption.ToBinary(), e.ToBinary()) {
+		T.Errorf("Unexpected encryption parameters %v", t.Encryption)
+	}
+
+	// hostile key derivation parameters
+	t.Encryption.LogN = 30
+	data = append(data[:len(data)-int(t.Size())], t.ToBinary()...)
+	if _, err := ReadTrailer(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrCorrupted) {
+		T.Errorf("Invalid scrypt parameters accepted: %v", err)
+	}
+}
+
+func TestScryptParameters(T *testing.T) {
+	cases := []struct {
+		logN uint8
+		r, p uint32
+		ok   bool
+	}{
+		{15, 8, 1, true},
+		{23, 1, 16, true},
+		{23, 2, 1, false},
+		{10, 1 << 13, 1, true},
+		{10, 1<<13 + 1, 1, false},
+		// 128*r*N overflows 64 bits
+		{30, 1 << 27, 1, false},
+		{25, 1 << 31, 1, false},
+		{0, 8, 1, false},
+		{15, 0, 1, false},
+		{15, 8, 17, false},
+	}
+	for _, c := range cases {
+		e := &Encryption{KDF: KDFScrypt, Cipher: CipherAESGCM, LogN: c.logN, R: c.r, P: c.p, Salt: make([]byte, saltSize)}
+		_, err := encryptionFromBinary(e.ToBinary())
+		if (err == nil) != c.ok {
+			T.Errorf("Unexpected result for N=2^%d, r=%d, p=%d: %v", c.logN, c.r, c.p, err)
+		}
+	}
+}
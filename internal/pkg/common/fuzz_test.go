@@ -0,0 +1,126 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const testdataRoot = "../../../test/testdata"
+
+// readTestFolder will read disk folder into Folder object
+func readTestFolder(c *Catalog, dir string) (*Folder, error) {
+	folder := NewFolder(filepath.Base(dir), false)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			f, err := readTestFolder(c, name)
+			if err != nil {
+				return nil, err
+			}
+			AddFolderToFolder(&folder, f)
+			continue
+		}
+		body, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		f := NewFile(entry.Name(), body)
+		c.AddFile(f)
+		AddFileToFolder(&folder, f)
+	}
+	return &folder, nil
+}
+
+// seedHeaders will build binary headers of the test/testdata folders
+func seedHeaders(tb testing.TB) [][]byte {
+	entries, err := ioutil.ReadDir(testdataRoot)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	seeds := make([][]byte, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		c := NewCatalog()
+		root, err := readTestFolder(c, filepath.Join(testdataRoot, entry.Name()))
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		// data is placed in the order of the hashes, empty files have no data
+		offsets := Offset{}
+		size := uint32(0)
+		for _, files := range c.Dirinfo {
+			if files[0].Size > 0 {
+				offsets[size] = files[0].Hashsum
+				size += uint32(files[0].Size)
+			}
+		}
+		h := NewHeader(size)
+		h.Marshal(root, &offsets)
+		h.Segment(SegmentRecord{Offset: 0, Size: size, Packed: size, Codec: CodecStore})
+		seeds = append(seeds, ToBinary(h))
+	}
+	return seeds
+}
+
+func TestSeedHeaders(T *testing.T) {
+	for _, seed := range seedHeaders(T) {
+		_, err := FromBinary(seed)
+		if err != nil {
+			T.Error(err)
+		}
+	}
+}
+
+func FuzzFromBinary(F *testing.F) {
+	for _, seed := range seedHeaders(F) {
+		F.Add(seed)
+	}
+	F.Fuzz(func(T *testing.T, b []byte) {
+		h, err := FromBinary(b)
+		if err != nil {
+			return
+		}
+
+		// accepted header is stable after the round trip
+		b2 := ToBinary(h)
+		h2, err := FromBinary(b2)
+		if err != nil {
+			T.Fatalf("Header is rejected after the round trip: %v", err)
+		}
+		if !bytes.Equal(ToBinary(h2), b2) {
+			T.Fatal("Header is changed after the round trip")
+		}
+		for i := range h.Folders {
+			h.FullPath(uint32(i + 1))
+		}
+	})
+}
@@ -27,6 +27,7 @@ import (
 	"fmt"
 	"runtime"
 	"sort"
+	"strings"
 )
 
 const (
@@ -38,6 +39,41 @@ const (
 
 	// FData is the bit for file record
 	FData uint8 = 2
+
+	// NoData is the data reference of the folders and empty files
+	NoData uint32 = 0xFFFFFFFF
+)
+
+const (
+	// CodecStore is the uncompressed segment
+	CodecStore uint8 = 0
+
+	// CodecLZMA is the LZMA level 8 compressed segment
+	CodecLZMA uint8 = 1
+
+	// CodecDeflateDict is the deflate compressed segment with the archive dictionary
+	CodecDeflateDict uint8 = 2
+
+	// CodecDeflate is the deflate compressed segment
+	CodecDeflate uint8 = 3
+)
+
+const (
+	// TransformNone is the segment of the untouched files
+	TransformNone uint8 = 0
+
+	// TransformClass is the segment of the grouped java classes
+	TransformClass uint8 = 1
+)
+
+const (
+	dataRecordSize      = 41
+	segmentRecordSize   = 14
+	folderRecordMinSize = 10
+	headerTailSize      = 20
+
+	legacyDataRecordSize = 40
+	legacyTailSize       = 8
 )
 
 var (
@@ -70,17 +106,40 @@ type FoldersHeader []FolderRecord
 type DataRecord struct {
 	Offset uint32 `json:"offset"`
 	Size   uint32 `json:"size"`
+	Filter uint8  `json:"filter"`
 	Hash   []byte `json:"hash"`
 }
 
 // DataHeader is the array of the pointers to the DataRecord objects.
 type DataHeader []*DataRecord
 
+// SegmentRecord is the type for independently compressed part of the data.
+// Offset and Size are in _uncompressed_ data array, Packed is the number of
+// bytes in archive file.
+type SegmentRecord struct {
+	Offset    uint32 `json:"offset"`
+	Size      uint32 `json:"size"`
+	Packed    uint32 `json:"packed"`
+	Codec     uint8  `json:"codec"`
+	Transform uint8  `json:"transform"`
+}
+
+// SegmentsHeader is the array of the pointers to the SegmentRecord objects.
+type SegmentsHeader []*SegmentRecord
+
 // Header is the structure of the archive header information.
 type Header struct {
-	Folders FoldersHeader `json:"folders"`
-	Data    DataHeader    `json:"data"`
-	Size    uint32        `json:"datasize"`
+	Folders    FoldersHeader  `json:"folders"`
+	Data       DataHeader     `json:"data"`
+	Segments   SegmentsHeader `json:"segments"`
+	Dictionary []byte         `json:"dictionary"`
+	Size       uint32         `json:"datasize"`
+
+	// Release is the properties of the JRE release file
+	Release Properties `json:"release,omitempty"`
+
+	// Metadata is the user defined properties of the archive
+	Metadata Properties `json:"metadata,omitempty"`
 }
 
 func (h Header) String() string {
@@ -91,9 +150,10 @@ func (h Header) String() string {
 // NewHeader will create new header object
 func NewHeader(packedSize uint32) *Header {
 	h := Header{
-		Folders: make(FoldersHeader, 0),
-		Data:    make(DataHeader, 0),
-		Size:    packedSize,
+		Folders:  make(FoldersHeader, 0),
+		Data:     make(DataHeader, 0),
+		Segments: make(SegmentsHeader, 0),
+		Size:     packedSize,
 	}
 	return &h
 }
@@ -106,7 +166,7 @@ type Packable interface {
 // FindDataOffset will find data offset by hash of the given File object.
 func (h *Header) FindDataOffset(f *File) uint32 {
 	if f.Size == 0 {
-		return 0xFFFFFFFF
+		return NoData
 	}
 	for _, dr := range h.Data {
 		if hmac.Equal(dr.Hash, f.Hashsum) {
@@ -129,7 +189,7 @@ func (h *Header) Fold(parentID uint32, f *Folder) uint32 {
 	rec := FolderRecord{
 		Parent:     parentID,
 		Flags:      flags,
-		Data:       0xFFFFFFFF,
+		Data:       NoData,
 		Namelength: uint8(nl),
 		Name:       nbytes,
 	}
@@ -152,6 +212,25 @@ func (h *Header) Fold(parentID uint32, f *Folder) uint32 {
 	return folderID
 }
 
+// FullPath will return path of the folder record by folderID.
+// Path is slash separated and contains names of the containers.
+func (h *Header) FullPath(folderID uint32) string {
+	names := make([]string, 0)
+	for id := folderID; id > 0 && id <= uint32(len(h.Folders)) && len(names) < len(h.Folders); {
+		rec := h.Folders[id-1]
+		if rec.Parent == 0 && string(rec.Name) == "_root_" {
+			break
+		}
+		names = append(names, string(rec.Name))
+		id = rec.Parent
+	}
+
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(names, "/")
+}
+
 // Pack will add new DataRecord into header
 func (h *Header) Pack(offset uint32, size uint32, hash []byte) {
 	rec := &DataRecord{
@@ -162,6 +241,11 @@ func (h *Header) Pack(offset uint32, size uint32, hash []byte) {
 	h.Data = append(h.Data, rec)
 }
 
+// Segment will add new SegmentRecord into header
+func (h *Header) Segment(seg SegmentRecord) {
+	h.Segments = append(h.Segments, &seg)
+}
+
 func marsh(h *Header, parentID uint32, folders []*Folder) {
 	for _, f := range folders {
 		id := h.Fold(parentID, f)
@@ -169,10 +253,25 @@ func marsh(h *Header, parentID uint32, folders []*Folder) {
 	}
 }
 
-// Marshal will serialize root folder and offests into headr object
+// ApplyFilters will set filters of the data records
+func (h *Header) ApplyFilters(filters *Filters) {
+	for _, dr := range h.Data {
+		if f, ok := (*filters)[dr.Offset]; ok {
+			dr.Filter = f
+		}
+	}
+}
+
+// Marshal will serialize root folder and offests into headr object.
+// Data records are in the offset order, so the same input gives the same header.
 func (h *Header) Marshal(folder *Folder, offsets *Offset) {
-	for offset, hash := range *offsets {
-		h.Pack(offset, 0, hash)
+	keys := make([]uint32, 0, len(*offsets))
+	for offset := range *offsets {
+		keys = append(keys, offset)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, offset := range keys {
+		h.Pack(offset, 0, (*offsets)[offset])
 	}
 	id := h.Fold(0, folder)
 	marsh(h, id, folder.Folders)
@@ -194,61 +293,239 @@ func ToBinary(h *Header) []byte {
 	for _, d := range h.Data {
 		binary.Write(buf, Order, d.Offset)
 		binary.Write(buf, Order, d.Size)
+		binary.Write(buf, Order, d.Filter)
 		binary.Write(buf, Order, d.Hash)
 	}
 
+	for _, s := range h.Segments {
+		binary.Write(buf, Order, s.Offset)
+		binary.Write(buf, Order, s.Size)
+		binary.Write(buf, Order, s.Packed)
+		binary.Write(buf, Order, s.Codec)
+		binary.Write(buf, Order, s.Transform)
+	}
+
+	buf.Write(h.Dictionary)
+
+	// sections are optional, header without them is the same as before
+	writeSection(buf, SectionRelease, h.Release)
+	writeSection(buf, SectionMetadata, h.Metadata)
+
+	binary.Write(buf, Order, uint32(len(h.Dictionary)))
+	binary.Write(buf, Order, uint32(len(h.Data)))
+	binary.Write(buf, Order, uint32(len(h.Segments)))
 	binary.Write(buf, Order, uint32(len(h.Folders)))
 	binary.Write(buf, Order, h.Size)
 	return buf.Bytes()
 }
 
+// binReader is the bounds-checked reader of the binary header
+type binReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *binReader) bytes(n int, what string) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b)-r.pos {
+		r.err = fmt.Errorf("%w: header is truncated at %s", ErrCorrupted, what)
+		return nil
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *binReader) uint8(what string) uint8 {
+	b := r.bytes(1, what)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *binReader) uint16(what string) uint16 {
+	b := r.bytes(2, what)
+	if b == nil {
+		return 0
+	}
+	return Order.Uint16(b)
+}
+
+func (r *binReader) uint32(what string) uint32 {
+	b := r.bytes(4, what)
+	if b == nil {
+		return 0
+	}
+	return Order.Uint32(b)
+}
+
 // FromBinary will parse bytes array into new Header object
-func FromBinary(b []byte) *Header {
+func FromBinary(b []byte) (*Header, error) {
+	return FromBinaryLimited(b, &Limits{})
+}
+
+// FromBinaryLimited will parse bytes array into new Header object. Number of
+// entries is checked against the limits before the records are read.
+func FromBinaryLimited(b []byte, limits *Limits) (*Header, error) {
 
 	l := len(b)
+	if l < headerTailSize {
+		return nil, fmt.Errorf("%w: header is too short: %d bytes", ErrCorrupted, l)
+	}
 
-	dataSize := Order.Uint32(b[l-4:])
+	tail := &binReader{b: b[l-headerTailSize:]}
+	dictionarySize := tail.uint32("tail")
+	dataNum := tail.uint32("tail")
+	segmentsNum := tail.uint32("tail")
+	foldersNum := tail.uint32("tail")
+	dataSize := tail.uint32("tail")
+
+	// records are followed by the dictionary, so all sizes are checked before allocation
+	body := int64(l - headerTailSize)
+	records := int64(dataNum)*dataRecordSize + int64(segmentsNum)*segmentRecordSize + int64(dictionarySize)
+	if records+int64(foldersNum)*folderRecordMinSize > body {
+		return nil, fmt.Errorf("%w: header records do not fit into %d bytes", ErrCorrupted, l)
+	}
+	err := limits.CheckEntries(int64(foldersNum))
+	if err != nil {
+		return nil, err
+	}
 
 	h := NewHeader(dataSize)
-	foldersNum := Order.Uint32(b[l-8 : l-4])
-	h.Folders = make(FoldersHeader, foldersNum)
-	offset := uint32(0)
-	for i := uint32(0); i < foldersNum; i++ {
-		parentID := Order.Uint32(b[offset : offset+4])
-		flags := uint8(b[offset+4])
-		dataID := Order.Uint32(b[offset+5 : offset+9])
-
-		namelength := uint8(b[offset+9])
-		name := b[offset+10 : offset+10+uint32(namelength)]
-		offset += (10 + uint32(namelength))
-		rec := FolderRecord{
-			Parent:     parentID,
-			Flags:      flags,
-			Data:       dataID,
-			Namelength: namelength,
-			Name:       name,
-		}
+	r := &binReader{b: b[:body]}
+	err = h.readFolders(r, foldersNum)
+	if err != nil {
+		return nil, err
+	}
 
-		h.Folders[i] = rec
+	if int64(r.pos)+records > body {
+		return nil, fmt.Errorf("%w: header size mismatch: %d bytes, expected %d bytes", ErrCorrupted, body, int64(r.pos)+records)
 	}
 
-	dataNum := ((l - 8) - int(offset)) / 40
 	h.Data = make(DataHeader, dataNum)
-	i := offset
-	x := 0
-	for i < uint32(l-8) {
-
+	for x := range h.Data {
 		h.Data[x] = &DataRecord{
-			Offset: Order.Uint32(b[i : i+4]),
-			Size:   Order.Uint32(b[i+4 : i+8]),
-			Hash:   b[i+8 : i+40],
+			Offset: r.uint32("data offset"),
+			Size:   r.uint32("data size"),
+			Filter: r.uint8("data filter"),
+			Hash:   r.bytes(dataRecordSize-9, "data hash"),
 		}
+	}
+
+	h.Segments = make(SegmentsHeader, segmentsNum)
+	for x := range h.Segments {
+		h.Segments[x] = &SegmentRecord{
+			Offset:    r.uint32("segment offset"),
+			Size:      r.uint32("segment size"),
+			Packed:    r.uint32("segment packed size"),
+			Codec:     r.uint8("segment codec"),
+			Transform: r.uint8("segment transform"),
+		}
+	}
 
-		i += 40
-		x++
+	if dictionarySize > 0 {
+		h.Dictionary = r.bytes(int(dictionarySize), "dictionary")
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	err = h.readSections(r)
+	if err != nil {
+		return nil, err
 	}
 
 	sort.Slice(h.Data, func(i, j int) bool { return h.Data[i].Offset < h.Data[j].Offset })
 	runtime.GC()
-	return h
+	err = h.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// FromLegacyBinary will parse bytes array of the header of the archive made
+// before the format versions. Such header is ended by the number of folders
+// and the data size, its data records have no filter and all files are packed
+// into the single LZMA stream of the packed size. Number of entries is checked
+// against the limits before the records are read.
+func FromLegacyBinary(b []byte, packedSize uint32, limits *Limits) (*Header, error) {
+
+	l := len(b)
+	if l < legacyTailSize {
+		return nil, fmt.Errorf("%w: header is too short: %d bytes", ErrCorrupted, l)
+	}
+
+	tail := &binReader{b: b[l-legacyTailSize:]}
+	foldersNum := tail.uint32("tail")
+	dataSize := tail.uint32("tail")
+
+	body := int64(l - legacyTailSize)
+	if int64(foldersNum)*folderRecordMinSize > body {
+		return nil, fmt.Errorf("%w: header records do not fit into %d bytes", ErrCorrupted, l)
+	}
+	err := limits.CheckEntries(int64(foldersNum))
+	if err != nil {
+		return nil, err
+	}
+
+	h := NewHeader(dataSize)
+	r := &binReader{b: b[:body]}
+	err = h.readFolders(r, foldersNum)
+	if err != nil {
+		return nil, err
+	}
+
+	records := body - int64(r.pos)
+	if records%legacyDataRecordSize != 0 {
+		return nil, fmt.Errorf("%w: header size mismatch: %d bytes of data records", ErrCorrupted, records)
+	}
+	h.Data = make(DataHeader, records/legacyDataRecordSize)
+	for x := range h.Data {
+		h.Data[x] = &DataRecord{
+			Offset: r.uint32("data offset"),
+			Size:   r.uint32("data size"),
+			Hash:   r.bytes(legacyDataRecordSize-8, "data hash"),
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if dataSize > 0 {
+		h.Segments = SegmentsHeader{{
+			Size:   dataSize,
+			Packed: packedSize,
+			Codec:  CodecLZMA,
+		}}
+	}
+
+	sort.Slice(h.Data, func(i, j int) bool { return h.Data[i].Offset < h.Data[j].Offset })
+	err = h.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// readFolders will parse the given number of the folder records
+func (h *Header) readFolders(r *binReader, n uint32) error {
+	h.Folders = make(FoldersHeader, n)
+	for i := range h.Folders {
+		rec := FolderRecord{
+			Parent: r.uint32("folder parent"),
+			Flags:  r.uint8("folder flags"),
+			Data:   r.uint32("folder data"),
+		}
+		rec.Namelength = r.uint8("folder name length")
+		rec.Name = r.bytes(int(rec.Namelength), "folder name")
+		if r.err != nil {
+			return r.err
+		}
+		h.Folders[i] = rec
+	}
+	return nil
 }
@@ -20,6 +20,8 @@
 package common
 
 import (
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -86,7 +88,10 @@ func TestToFromBinary(T *testing.T) {
 	bytes := ToBinary(h)
 	T.Logf("Bytes: %v", bytes)
 
-	h2 := FromBinary(bytes)
+	h2, err := FromBinary(bytes)
+	if err != nil {
+		T.Fatal(err)
+	}
 
 	T.Logf("Readed header: %v", h2)
 	if h2.Size != 1000 {
@@ -157,3 +162,144 @@ func TestToFromBinary(T *testing.T) {
 		T.Errorf("Unexpected name for f4: %s", n)
 	}
 }
+
+func TestSegmentsToFromBinary(T *testing.T) {
+	f1 := NewFolder("f1", false)
+
+	h := NewHeader(300)
+	h.Fold(0, &f1)
+	h.Pack(0, 100, make([]byte, 32))
+	h.Pack(100, 200, make([]byte, 32))
+	h.ApplyFilters(&Filters{100: 2})
+	h.Segment(SegmentRecord{Offset: 0, Size: 100, Packed: 50, Codec: CodecLZMA, Transform: TransformNone})
+	h.Segment(SegmentRecord{Offset: 100, Size: 200, Packed: 70, Codec: CodecLZMA, Transform: TransformClass})
+	h.Dictionary = []byte("some dictionary")
+
+	h2, err := FromBinary(ToBinary(h))
+	if err != nil {
+		T.Fatal(err)
+	}
+	if len(h2.Folders) != 1 {
+		T.Errorf("Unexpected folders number %d", len(h2.Folders))
+	}
+	if len(h2.Data) != 2 {
+		T.Fatalf("Unexpected data number %d", len(h2.Data))
+	}
+	if h2.Data[1].Offset != 100 || h2.Data[1].Size != 200 || h2.Data[1].Filter != 2 {
+		T.Errorf("Unexpected data record %v", h2.Data[1])
+	}
+	if len(h2.Segments) != 2 {
+		T.Fatalf("Unexpected segments number %d", len(h2.Segments))
+	}
+	for i, s := range h.Segments {
+		if *s != *h2.Segments[i] {
+			T.Errorf("Unexpected segment %v, expected %v", *h2.Segments[i], *s)
+		}
+	}
+	if string(h2.Dictionary) != "some dictionary" {
+		T.Errorf("Unexpected dictionary %v", h2.Dictionary)
+	}
+}
+
+func TestFullPath(T *testing.T) {
+	f1 := NewFolder("_root_", false)
+	f2 := NewFolder("lib", false)
+	f3 := NewFolder("rt.jar", true)
+	f4 := NewFolder("java", false)
+
+	h := NewHeader(1000)
+	f1id := h.Fold(0, &f1)
+	f2id := h.Fold(f1id, &f2)
+	f3id := h.Fold(f2id, &f3)
+	f4id := h.Fold(f3id, &f4)
+
+	tests := map[uint32]string{
+		0:    "",
+		f1id: "",
+		f2id: "lib",
+		f3id: "lib/rt.jar",
+		f4id: "lib/rt.jar/java",
+	}
+	for id, expected := range tests {
+		if p := h.FullPath(id); p != expected {
+			T.Errorf("Unexpected path %q of %d, expected %q", p, id, expected)
+		}
+	}
+}
+
+func TestFromBinaryTruncated(T *testing.T) {
+	f1 := NewFolder("f1", false)
+	h := NewHeader(300)
+	h.Fold(0, &f1)
+	h.Pack(0, 300, make([]byte, 32))
+	h.Segment(SegmentRecord{Offset: 0, Size: 300, Packed: 50, Codec: CodecLZMA})
+	h.Dictionary = []byte("some dictionary")
+	b := ToBinary(h)
+
+	for l := 0; l < len(b); l++ {
+		_, err := FromBinary(b[:l])
+		if !errors.Is(err, ErrCorrupted) {
+			T.Errorf("Truncated header of %d bytes accepted: %v", l, err)
+		}
+		_, err = FromBinary(b[len(b)-l:])
+		if !errors.Is(err, ErrCorrupted) {
+			T.Errorf("Header without first %d bytes accepted: %v", len(b)-l, err)
+		}
+	}
+
+	// huge number of folders
+	damaged := append([]byte(nil), b...)
+	Order.PutUint32(damaged[len(damaged)-8:], 0xFFFFFFF0)
+	_, err := FromBinary(damaged)
+	if !errors.Is(err, ErrCorrupted) {
+		T.Errorf("Damaged header accepted: %v", err)
+	}
+}
+
+func TestValidate(T *testing.T) {
+	h := NewHeader(20)
+	h.Pack(0, 10, make([]byte, 32))
+	h.Pack(10, 10, make([]byte, 32))
+	h.Segment(SegmentRecord{Offset: 0, Size: 20, Packed: 20})
+	h.Folders = FoldersHeader{
+		{Parent: 0, Flags: FFolder, Data: NoData, Namelength: 6, Name: []byte("_root_")},
+		{Parent: 1, Flags: FData, Data: 0, Namelength: 4, Name: []byte("good")},
+		{Parent: 1, Flags: FData, Data: 5, Namelength: 11, Name: []byte("missingdata")},
+		{Parent: 99, Flags: FData, Data: 0, Namelength: 13, Name: []byte("missingparent")},
+		{Parent: 6, Flags: FFolder, Data: NoData, Namelength: 6, Name: []byte("cycle1")},
+		{Parent: 5, Flags: FFolder, Data: NoData, Namelength: 6, Name: []byte("cycle2")},
+		{Parent: 2, Flags: FData, Data: 0, Namelength: 10, Name: []byte("fileparent")},
+		{Parent: 1, Flags: FData, Data: 10, Namelength: 200, Name: []byte("namelength")},
+		{Parent: 1, Flags: 7, Data: NoData, Namelength: 5, Name: []byte("flags")},
+		{Parent: 1, Flags: FFolder, Data: 0, Namelength: 10, Name: []byte("folderdata")},
+		{Parent: 5, Flags: FFolder, Data: NoData, Namelength: 7, Name: []byte("tocycle")},
+	}
+
+	err := h.Validate()
+	var e *ValidationError
+	if !errors.As(err, &e) || !errors.Is(err, ErrCorrupted) {
+		T.Fatalf("Unexpected error %v", err)
+	}
+	expected := []string{"missingdata", "missingparent", "cycle1", "cycle2", "fileparent",
+		"namelength", "flags", "folderdata", "tocycle"}
+	if len(e.Problems) != len(expected) {
+		T.Fatalf("Unexpected problems %v", e.Problems)
+	}
+	for i, name := range expected {
+		if !strings.Contains(e.Problems[i], name) {
+			T.Errorf("Unexpected problem %q, expected %s", e.Problems[i], name)
+		}
+	}
+
+	h.Folders = h.Folders[:2]
+	if err := h.Validate(); err != nil {
+		T.Errorf("Valid header is rejected: %v", err)
+	}
+
+	h.Data[1].Offset = 5
+	h.Data = append(h.Data, &DataRecord{Offset: 30, Size: 1, Hash: make([]byte, 32)})
+	err = h.Validate()
+	if !errors.As(err, &e) || len(e.Problems) != 2 {
+		T.Errorf("Unexpected error %v", err)
+	}
+}
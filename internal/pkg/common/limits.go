@@ -0,0 +1,134 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrLimit is the error for the archive, which exceeds the resource limits
+	ErrLimit = errors.New("Archive exceeds resource limits")
+)
+
+// Limits is the set of the resource limits for the untrusted archives.
+// Zero limit means no limit.
+type Limits struct {
+	// MaxTotalSize is the maximum number of the unpacked bytes
+	MaxTotalSize int64
+
+	// MaxFileSize is the maximum size of the single file
+	MaxFileSize int64
+
+	// MaxEntries is the maximum number of the folder records
+	MaxEntries int
+
+	// MaxDepth is the maximum number of the path elements
+	MaxDepth int
+
+	// MaxHeaderSize is the maximum size of the packed and unpacked header
+	MaxHeaderSize int64
+}
+
+// DefaultLimits is the set of limits, sufficient for any JRE
+var DefaultLimits = Limits{
+	MaxTotalSize:  2 * 1024 * 1024 * 1024,
+	MaxFileSize:   512 * 1024 * 1024,
+	MaxEntries:    1000000,
+	MaxDepth:      64,
+	MaxHeaderSize: 128 * 1024 * 1024,
+}
+
+func exceeds(value int64, limit int64) bool {
+	return limit > 0 && value > limit
+}
+
+// CheckSize will check the size of the packed or unpacked header
+func (l *Limits) CheckSize(what string, size int64) error {
+	if exceeds(size, l.MaxHeaderSize) {
+		return fmt.Errorf("%w: %s size is %d bytes, limit is %d bytes", ErrLimit, what, size, l.MaxHeaderSize)
+	}
+	return nil
+}
+
+// CheckData will check the size of the decoded data
+func (l *Limits) CheckData(fileSize int64, totalSize int64) error {
+	if exceeds(fileSize, l.MaxFileSize) {
+		return fmt.Errorf("%w: file size is %d bytes, limit is %d bytes", ErrLimit, fileSize, l.MaxFileSize)
+	}
+	if exceeds(totalSize, l.MaxTotalSize) {
+		return fmt.Errorf("%w: unpacked size is %d bytes, limit is %d bytes", ErrLimit, totalSize, l.MaxTotalSize)
+	}
+	return nil
+}
+
+// CheckEntries will check the number of the header entries
+func (l *Limits) CheckEntries(n int64) error {
+	if exceeds(n, int64(l.MaxEntries)) {
+		return fmt.Errorf("%w: %d entries, limit is %d entries", ErrLimit, n, l.MaxEntries)
+	}
+	return nil
+}
+
+// CheckLimits will check the header against the limits
+func (h *Header) CheckLimits(l *Limits) error {
+	err := l.CheckEntries(int64(len(h.Folders)))
+	if err != nil {
+		return err
+	}
+	err = l.CheckData(0, int64(h.Size))
+	if err != nil {
+		return err
+	}
+	for _, d := range h.Data {
+		err = l.CheckData(int64(d.Size), 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	if l.MaxDepth <= 0 {
+		return nil
+	}
+	// depth of the parent is always known, when parents are placed before children
+	depth := make([]int, len(h.Folders))
+	for i := range h.Folders {
+		depth[i] = h.depth(uint32(i+1), depth, l.MaxDepth)
+		if depth[i] > l.MaxDepth {
+			return fmt.Errorf("%w: path %s is deeper than %d", ErrLimit, h.FullPath(uint32(i+1)), l.MaxDepth)
+		}
+	}
+	return nil
+}
+
+// depth will calculate number of the path elements of the folder record,
+// calculation is stopped after the max depth
+func (h *Header) depth(id uint32, known []int, max int) int {
+	d := 0
+	for id > 0 && int(id) <= len(h.Folders) && d <= max {
+		if known[id-1] > 0 {
+			return d + known[id-1]
+		}
+		d++
+		id = h.Folders[id-1].Parent
+	}
+	return d
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCheckLimits(T *testing.T) {
+	f1 := NewFolder("_root_", false)
+	f2 := NewFolder("lib", false)
+	f3 := NewFolder("server", false)
+	h := NewHeader(300)
+	f1id := h.Fold(0, &f1)
+	f2id := h.Fold(f1id, &f2)
+	h.Fold(f2id, &f3)
+	h.Pack(0, 100, make([]byte, 32))
+	h.Pack(100, 200, make([]byte, 32))
+
+	cases := []struct {
+		limits Limits
+		ok     bool
+	}{
+		{Limits{}, true},
+		{DefaultLimits, true},
+		{Limits{MaxEntries: 3, MaxDepth: 3, MaxTotalSize: 300, MaxFileSize: 200}, true},
+		{Limits{MaxEntries: 2}, false},
+		{Limits{MaxDepth: 2}, false},
+		{Limits{MaxTotalSize: 299}, false},
+		{Limits{MaxFileSize: 199}, false},
+	}
+	for _, c := range cases {
+		err := h.CheckLimits(&c.limits)
+		if c.ok && err != nil {
+			T.Errorf("Limits %v: unexpected error %v", c.limits, err)
+		}
+		if !c.ok && !errors.Is(err, ErrLimit) {
+			T.Errorf("Limits %v: unexpected error %v", c.limits, err)
+		}
+	}
+
+	l := Limits{MaxEntries: 2}
+	if _, err := FromBinaryLimited(ToBinary(h), &l); !errors.Is(err, ErrLimit) {
+		T.Errorf("Entries are not limited while parsing: %v", err)
+	}
+
+	l = Limits{MaxHeaderSize: 10}
+	if l.CheckSize("header", 10) != nil || !errors.Is(l.CheckSize("header", 11), ErrLimit) {
+		T.Error("Header size is not checked")
+	}
+}
+
+// TestEntriesLimitAllocations tests, that the oversized number of entries is
+// refused before the folder records are allocated
+func TestEntriesLimitAllocations(T *testing.T) {
+	h := NewHeader(0)
+	for i := 0; i < 1000; i++ {
+		f := NewFolder(fmt.Sprintf("folder%d", i), false)
+		h.Fold(0, &f)
+	}
+	b := ToBinary(h)
+
+	l := Limits{MaxEntries: 10}
+	allocs := testing.AllocsPerRun(10, func() {
+		_, err := FromBinaryLimited(b, &l)
+		if !errors.Is(err, ErrLimit) {
+			T.Fatalf("Oversized number of entries accepted: %v", err)
+		}
+	})
+	if allocs > 10 {
+		T.Errorf("%v allocations before the number of entries is checked", allocs)
+	}
+	allocs = testing.AllocsPerRun(1, func() {
+		_, _ = FromBinary(b)
+	})
+	if allocs < 1000 {
+		T.Errorf("Unexpected %v allocations of the whole header", allocs)
+	}
+}
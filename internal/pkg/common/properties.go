@@ -0,0 +1,207 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ReleaseFile is the name of the JRE release file in the root folder
+	ReleaseFile = "release"
+
+	// maxReleaseSize is the size of the biggest release file, which is parsed
+	maxReleaseSize = 1024 * 1024
+)
+
+const (
+	// SectionRelease is the header section of the JRE release file properties
+	SectionRelease uint8 = 1
+
+	// SectionMetadata is the header section of the user defined metadata
+	SectionMetadata uint8 = 2
+
+	// maxPropertyKey is the size of the longest property key
+	maxPropertyKey = 0xFFFF
+)
+
+// Property is the key and value of the archive metadata
+type Property struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Properties is the ordered list of the archive metadata
+type Properties []Property
+
+// Get will return value of the key, or empty string when there is no such key
+func (p Properties) Get(key string) string {
+	for _, prop := range p {
+		if prop.Key == key {
+			return prop.Value
+		}
+	}
+	return ""
+}
+
+// Validate will check, that keys are not empty, not too long and unique
+func (p Properties) Validate() error {
+	keys := make(map[string]bool, len(p))
+	for _, prop := range p {
+		switch {
+		case prop.Key == "":
+			return fmt.Errorf("Metadata key is empty")
+		case len(prop.Key) > maxPropertyKey:
+			return fmt.Errorf("Metadata key %.32s... is longer than %d bytes", prop.Key, maxPropertyKey)
+		case keys[prop.Key]:
+			return fmt.Errorf("Duplicate metadata key %s", prop.Key)
+		}
+		keys[prop.Key] = true
+	}
+	return nil
+}
+
+// ParseProperty will parse the key=value string
+func ParseProperty(s string) (Property, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return Property{}, fmt.Errorf("Metadata %q is not key=value", s)
+	}
+	return Property{Key: s[:i], Value: s[i+1:]}, nil
+}
+
+/*
+ParseRelease will parse the JRE release file. Lines are KEY="value", values
+are unquoted. Empty lines, comments, lines without '=' and lines with the key
+longer than 65535 bytes are skipped.
+*/
+func ParseRelease(r io.Reader) (Properties, error) {
+	p := make(Properties, 0)
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxReleaseSize)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:i])
+		if len(key) > maxPropertyKey {
+			continue
+		}
+		value := strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		p = append(p, Property{Key: key, Value: value})
+	}
+	return p, s.Err()
+}
+
+// ReadRelease will parse the release file of the JRE folder. It returns nil
+// properties when there is no release file or it is not the regular file.
+func ReadRelease(folder string) (Properties, error) {
+	filename := filepath.Join(folder, ReleaseFile)
+	fi, err := os.Lstat(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() || fi.Size() > maxReleaseSize {
+		return nil, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseRelease(f)
+}
+
+// writeSection will write the properties as the header section. Properties
+// with the key longer than 65535 bytes are skipped, they can not be read back.
+func writeSection(buf *bytes.Buffer, id uint8, p Properties) {
+	section := new(bytes.Buffer)
+	for _, prop := range p {
+		if len(prop.Key) > maxPropertyKey {
+			continue
+		}
+		binary.Write(section, Order, uint16(len(prop.Key)))
+		section.WriteString(prop.Key)
+		binary.Write(section, Order, uint32(len(prop.Value)))
+		section.WriteString(prop.Value)
+	}
+	if section.Len() == 0 {
+		return
+	}
+	binary.Write(buf, Order, id)
+	binary.Write(buf, Order, uint32(section.Len()))
+	buf.Write(section.Bytes())
+}
+
+// readSection will parse the properties of the header section
+func readSection(b []byte) (Properties, error) {
+	r := &binReader{b: b}
+	p := make(Properties, 0)
+	for r.pos < len(b) && r.err == nil {
+		key := r.bytes(int(r.uint16("property key length")), "property key")
+		value := r.bytes(int(r.uint32("property value length")), "property value")
+		p = append(p, Property{Key: string(key), Value: string(value)})
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return p, nil
+}
+
+// readSections will parse the header sections, unknown sections are skipped
+func (h *Header) readSections(r *binReader) error {
+	for r.pos < len(r.b) && r.err == nil {
+		id := r.uint8("section id")
+		b := r.bytes(int(r.uint32("section size")), "section")
+		if r.err != nil {
+			break
+		}
+		var err error
+		switch id {
+		case SectionRelease:
+			h.Release, err = readSection(b)
+		case SectionMetadata:
+			h.Metadata, err = readSection(b)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: header section %d: %v", ErrCorrupted, id, err)
+		}
+	}
+	return r.err
+}
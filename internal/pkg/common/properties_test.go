@@ -0,0 +1,138 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseRelease(T *testing.T) {
+	release := `# release file
+IMPLEMENTOR="Oracle Corporation"
+JAVA_VERSION="11.0.2"
+OS_ARCH=x86_64
+
+MODULES="java.base java.logging"
+broken line
+` + strings.Repeat("K", maxPropertyKey+1) + `="too long key"
+`
+	p, err := ParseRelease(strings.NewReader(release))
+	if err != nil {
+		T.Fatal(err)
+	}
+	expected := Properties{
+		{"IMPLEMENTOR", "Oracle Corporation"},
+		{"JAVA_VERSION", "11.0.2"},
+		{"OS_ARCH", "x86_64"},
+		{"MODULES", "java.base java.logging"},
+	}
+	if len(p) != len(expected) {
+		T.Fatalf("Unexpected properties %v", p)
+	}
+	for i, prop := range expected {
+		if p[i] != prop {
+			T.Errorf("Unexpected property %v, expected %v", p[i], prop)
+		}
+	}
+	if p.Get("JAVA_VERSION") != "11.0.2" || p.Get("OS_NAME") != "" {
+		T.Errorf("Unexpected values of %v", p)
+	}
+}
+
+func TestHeaderSections(T *testing.T) {
+	f1 := NewFolder("f1", false)
+	h := NewHeader(300)
+	h.Fold(0, &f1)
+	h.Pack(0, 300, make([]byte, 32))
+	h.Segment(SegmentRecord{Offset: 0, Size: 300, Packed: 50, Codec: CodecLZMA})
+	h.Release = Properties{{"JAVA_VERSION", "1.8.0_172"}, {"OS_NAME", "Windows"}}
+	h.Metadata = Properties{{"build", "1234"}, {"channel", ""}}
+	b := ToBinary(h)
+
+	h2, err := FromBinary(b)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if len(h2.Release) != 2 || h2.Release.Get("OS_NAME") != "Windows" || len(h2.Data) != 1 {
+		T.Errorf("Unexpected header %v", h2)
+	}
+	if len(h2.Metadata) != 2 || h2.Metadata[0] != h.Metadata[0] || h2.Metadata[1] != h.Metadata[1] {
+		T.Errorf("Unexpected metadata %v", h2.Metadata)
+	}
+
+	// too long keys are skipped, instead of the truncated length
+	h.Release = append(h.Release, Property{strings.Repeat("K", maxPropertyKey+1), "value"})
+	h2, err = FromBinary(ToBinary(h))
+	if err != nil {
+		T.Fatal(err)
+	}
+	if len(h2.Release) != 2 || len(h2.Metadata) != 2 {
+		T.Errorf("Unexpected sections %v, %v", h2.Release, h2.Metadata)
+	}
+	h.Release = h.Release[:2]
+
+	// unknown sections are skipped
+	tail := len(b) - headerTailSize
+	unknown := append(append([]byte(nil), b[:tail]...), 0x7F, 0, 0, 0, 3, 'a', 'b', 'c')
+	unknown = append(unknown, b[tail:]...)
+	h2, err = FromBinary(unknown)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if h2.Release.Get("JAVA_VERSION") != "1.8.0_172" {
+		T.Errorf("Unexpected release %v", h2.Release)
+	}
+
+	// damaged section size
+	damaged := append(append([]byte(nil), b[:tail]...), 0x7F, 0, 0, 1, 0)
+	damaged = append(damaged, b[tail:]...)
+	_, err = FromBinary(damaged)
+	if !errors.Is(err, ErrCorrupted) {
+		T.Errorf("Damaged section accepted: %v", err)
+	}
+}
+
+func TestMetadataValidate(T *testing.T) {
+	p, err := ParseProperty("commit=ab=cd")
+	if err != nil || p.Key != "commit" || p.Value != "ab=cd" {
+		T.Errorf("Unexpected property %v: %v", p, err)
+	}
+	for _, s := range []string{"", "novalue", "=value"} {
+		if _, err := ParseProperty(s); err == nil {
+			T.Errorf("Wrong property %q accepted", s)
+		}
+	}
+
+	if err := (Properties{{"build", "1"}, {"channel", "beta"}}).Validate(); err != nil {
+		T.Error(err)
+	}
+	wrong := []Properties{
+		{{"", "1"}},
+		{{"build", "1"}, {"build", "2"}},
+		{{strings.Repeat("k", maxPropertyKey+1), "1"}},
+	}
+	for _, p := range wrong {
+		if err := p.Validate(); err == nil {
+			T.Errorf("Wrong metadata %.40v accepted", p)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	// SignatureMagic is the last bytes of the signature block
+	SignatureMagic = "JSIG"
+
+	signatureContext = "jrepack archive signature v1\x00"
+	signatureSize    = ed25519.PublicKeySize + ed25519.SignatureSize + trailerTailSize
+)
+
+var (
+	// ErrUnsigned is the error for the archive without signature
+	ErrUnsigned = errors.New("Archive is not signed")
+
+	// ErrSignature is the error for the wrong or untrusted signature
+	ErrSignature = errors.New("Archive signature is invalid")
+)
+
+/*
+Signature is the Ed25519 signature of the archive trailer. Trailer contains
+checksums of the header and of the whole archive, so the signature covers all
+data. Signature is embedded after the trailer or detached into the separate file.
+*/
+type Signature struct {
+	PublicKey ed25519.PublicKey `json:"publickey"`
+	Signature []byte            `json:"signature"`
+}
+
+func signedMessage(t *Trailer) []byte {
+	return append([]byte(signatureContext), t.ToBinary()...)
+}
+
+// Sign will create signature of the trailer
+func Sign(t *Trailer, key ed25519.PrivateKey) *Signature {
+	return &Signature{
+		PublicKey: key.Public().(ed25519.PublicKey),
+		Signature: ed25519.Sign(key, signedMessage(t)),
+	}
+}
+
+// Verify will check signature of the trailer against the trusted public keys
+func (s *Signature) Verify(t *Trailer, trusted []ed25519.PublicKey) error {
+	for _, key := range trusted {
+		if bytes.Equal(key, s.PublicKey) {
+			if ed25519.Verify(key, signedMessage(t), s.Signature) {
+				return nil
+			}
+			return fmt.Errorf("%w: archive is tampered", ErrSignature)
+		}
+	}
+	return fmt.Errorf("%w: untrusted key %s", ErrSignature, hex.EncodeToString(s.PublicKey))
+}
+
+// ToBinary will transform signature into bytearray.
+// Signature is ended by the signature block size and the magic.
+func (s *Signature) ToBinary() []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(s.PublicKey)
+	buf.Write(s.Signature)
+	binary.Write(buf, Order, uint32(signatureSize))
+	buf.WriteString(SignatureMagic)
+	return buf.Bytes()
+}
+
+// SignatureFromBinary will parse signature block
+func SignatureFromBinary(b []byte) (*Signature, error) {
+	if len(b) != signatureSize || string(b[len(b)-4:]) != SignatureMagic ||
+		Order.Uint32(b[len(b)-trailerTailSize:]) != signatureSize {
+		return nil, fmt.Errorf("%w: invalid signature block", ErrSignature)
+	}
+	return &Signature{
+		PublicKey: ed25519.PublicKey(b[:ed25519.PublicKeySize]),
+		Signature: b[ed25519.PublicKeySize : ed25519.PublicKeySize+ed25519.SignatureSize],
+	}, nil
+}
+
+// ReadSignature will read signature, embedded at the end of the archive of
+// the given size. Archive size without signature is returned, signature is
+// nil for the unsigned archive.
+func ReadSignature(r io.ReaderAt, size int64) (*Signature, int64, error) {
+	if size < signatureSize {
+		return nil, size, nil
+	}
+	tail := make([]byte, 4)
+	_, err := r.ReadAt(tail, size-4)
+	if err != nil {
+		return nil, size, fmt.Errorf("Unable to read signature: %v", err)
+	}
+	if string(tail) != SignatureMagic {
+		return nil, size, nil
+	}
+
+	b := make([]byte, signatureSize)
+	_, err = r.ReadAt(b, size-signatureSize)
+	if err != nil {
+		return nil, size, fmt.Errorf("Unable to read signature: %v", err)
+	}
+	s, err := SignatureFromBinary(b)
+	return s, size - signatureSize, err
+}
+
+// GenerateKey will create new key pair
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
+
+// WriteKey will write public or private key as hex string into the file
+func WriteKey(filename string, key []byte) error {
+	return ioutil.WriteFile(filename, []byte(hex.EncodeToString(key)+"\n"), 0600)
+}
+
+func readKey(filename string, size int) ([]byte, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != size {
+		return nil, fmt.Errorf("Invalid key file %s", filename)
+	}
+	return key, nil
+}
+
+// ReadPublicKey will read public key from the file
+func ReadPublicKey(filename string) (ed25519.PublicKey, error) {
+	key, err := readKey(filename, ed25519.PublicKeySize)
+	return ed25519.PublicKey(key), err
+}
+
+// ReadPrivateKey will read private key from the file
+func ReadPrivateKey(filename string) (ed25519.PrivateKey, error) {
+	key, err := readKey(filename, ed25519.PrivateKeySize)
+	return ed25519.PrivateKey(key), err
+}
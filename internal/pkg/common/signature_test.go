@@ -0,0 +1,119 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func signedArchive(T *testing.T, key ed25519.PrivateKey) ([]byte, *Trailer) {
+	header := []byte("header")
+	data := []byte("some data and header")
+	trailer := NewTrailer(uint32(len(data)), header)
+	data = append(data, header...)
+	err := trailer.Seal(bytes.NewReader(data))
+	if err != nil {
+		T.Fatal(err)
+	}
+	data = append(data, trailer.ToBinary()...)
+	return append(data, Sign(trailer, key).ToBinary()...), trailer
+}
+
+func TestSignature(T *testing.T) {
+	public, private, err := GenerateKey()
+	if err != nil {
+		T.Fatal(err)
+	}
+	other, _, err := GenerateKey()
+	if err != nil {
+		T.Fatal(err)
+	}
+	data, trailer := signedArchive(T, private)
+
+	s, size, err := ReadSignature(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		T.Fatal(err)
+	}
+	if s == nil || size != int64(len(data))-signatureSize {
+		T.Fatalf("Unexpected signature %v of size %d", s, size)
+	}
+	t, err := ReadTrailer(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		T.Fatal(err)
+	}
+	if !bytes.Equal(t.ToBinary(), trailer.ToBinary()) {
+		T.Error("Unexpected trailer of the signed archive")
+	}
+
+	if err := s.Verify(t, []ed25519.PublicKey{other, public}); err != nil {
+		T.Error(err)
+	}
+	if err := s.Verify(t, []ed25519.PublicKey{other}); !errors.Is(err, ErrSignature) {
+		T.Errorf("Untrusted key accepted: %v", err)
+	}
+	t.ArchiveHash[0] ^= 0xFF
+	if err := s.Verify(t, []ed25519.PublicKey{public}); !errors.Is(err, ErrSignature) {
+		T.Errorf("Tampered trailer accepted: %v", err)
+	}
+
+	unsigned := data[:size]
+	s, _, err = ReadSignature(bytes.NewReader(unsigned), int64(len(unsigned)))
+	if s != nil || err != nil {
+		T.Errorf("Unexpected signature of unsigned archive %v: %v", s, err)
+	}
+
+	_, err = SignatureFromBinary(data[size+1:])
+	if !errors.Is(err, ErrSignature) {
+		T.Errorf("Damaged signature accepted: %v", err)
+	}
+}
+
+func TestKeyFiles(T *testing.T) {
+	public, private, err := GenerateKey()
+	if err != nil {
+		T.Fatal(err)
+	}
+	name, _ := filepath.Abs("../../../test/output/testkey")
+	defer os.Remove(name + ".pub")
+	defer os.Remove(name + ".key")
+
+	if err := WriteKey(name+".pub", public); err != nil {
+		T.Fatal(err)
+	}
+	if err := WriteKey(name+".key", private); err != nil {
+		T.Fatal(err)
+	}
+	p, err := ReadPublicKey(name + ".pub")
+	if err != nil || !bytes.Equal(p, public) {
+		T.Errorf("Unexpected public key: %v", err)
+	}
+	k, err := ReadPrivateKey(name + ".key")
+	if err != nil || !bytes.Equal(k, private) {
+		T.Errorf("Unexpected private key: %v", err)
+	}
+	if _, err := ReadPrivateKey(name + ".pub"); err == nil {
+		T.Error("Public key is read as private")
+	}
+}
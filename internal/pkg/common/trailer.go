@@ -0,0 +1,263 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// FormatVersionLegacy is the version of the archive made before the
+	// format versions. Such archive is ended by the size of the packed header
+	// and has no checksums.
+	FormatVersionLegacy uint16 = 1
+
+	// FormatVersion is the current version of the archive format
+	FormatVersion uint16 = 2
+
+	// FormatVersionEncrypted is the version of the encrypted archive format.
+	// Trailer of the encrypted archive is ended by the encryption parameters.
+	FormatVersionEncrypted uint16 = 3
+
+	// TrailerMagic is the last bytes of the archive file
+	TrailerMagic = "JRPK"
+
+	trailerTailSize   = 8
+	legacyTrailerSize = 4
+	checksumSize      = sha256.Size
+	trailerBodySize   = 10 + 2*checksumSize
+)
+
+var (
+	// ErrCorrupted is the error for the truncated or damaged archive
+	ErrCorrupted = errors.New("Archive is corrupted")
+)
+
+// Trailer is the tail of the archive file. It is placed after the packed header.
+type Trailer struct {
+	Version     uint16 `json:"version"`
+	HeaderSize  uint32 `json:"headersize"`
+	DataSize    uint32 `json:"datasize"`
+	HeaderHash  []byte `json:"headerhash"`
+	ArchiveHash []byte `json:"archivehash"`
+
+	// Encryption is nil for the archive, which is not encrypted
+	Encryption *Encryption `json:"encryption,omitempty"`
+}
+
+// NewTrailer will create new trailer object for the current format version.
+// DataSize is the number of bytes of the data segments in archive file, header
+// is the packed header.
+func NewTrailer(dataSize uint32, header []byte) *Trailer {
+	hash := sha256.Sum256(header)
+	return &Trailer{
+		Version:     FormatVersion,
+		HeaderSize:  uint32(len(header)),
+		DataSize:    dataSize,
+		HeaderHash:  hash[:],
+		ArchiveHash: make([]byte, checksumSize),
+	}
+}
+
+// ToBinary will transform trailer into bytearray.
+// Trailer is ended by the trailer size and the magic.
+func (t *Trailer) ToBinary() []byte {
+	buf := new(bytes.Buffer)
+	if t.Version == FormatVersionLegacy {
+		binary.Write(buf, Order, t.HeaderSize)
+		return buf.Bytes()
+	}
+	binary.Write(buf, Order, t.Version)
+	binary.Write(buf, Order, t.HeaderSize)
+	binary.Write(buf, Order, t.DataSize)
+	buf.Write(t.HeaderHash)
+	buf.Write(t.ArchiveHash)
+	if t.Encryption != nil {
+		buf.Write(t.Encryption.ToBinary())
+	}
+
+	binary.Write(buf, Order, uint32(buf.Len()+trailerTailSize))
+	buf.WriteString(TrailerMagic)
+	return buf.Bytes()
+}
+
+// ReadTrailer will read trailer from the end of the archive of the given size.
+// Embedded signature is skipped. Archive size is checked against sizes of the
+// data and header. Archive without the magic is read as the legacy one.
+func ReadTrailer(r io.ReaderAt, size int64) (*Trailer, error) {
+	_, size, err := ReadSignature(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if size < trailerTailSize {
+		return nil, fmt.Errorf("%w: archive is too short: %d bytes", ErrCorrupted, size)
+	}
+
+	tail := make([]byte, trailerTailSize)
+	_, err = r.ReadAt(tail, size-trailerTailSize)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read trailer: %v", err)
+	}
+	if string(tail[4:]) != TrailerMagic {
+		return readLegacyTrailer(tail[4:], size)
+	}
+
+	l := int64(Order.Uint32(tail))
+	if l < trailerTailSize+2 || l > size {
+		return nil, fmt.Errorf("%w: invalid trailer size %d", ErrCorrupted, l)
+	}
+
+	b := make([]byte, l)
+	_, err = r.ReadAt(b, size-l)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read trailer: %v", err)
+	}
+
+	version := Order.Uint16(b[0:2])
+	bodySize := int64(trailerBodySize)
+	switch version {
+	case FormatVersion:
+	case FormatVersionEncrypted:
+		bodySize += encryptionSize
+	default:
+		return nil, fmt.Errorf("Unsupported archive version %d", version)
+	}
+	if l != bodySize+trailerTailSize {
+		return nil, fmt.Errorf("%w: invalid trailer size %d", ErrCorrupted, l)
+	}
+
+	t := &Trailer{
+		Version:     version,
+		HeaderSize:  Order.Uint32(b[2:6]),
+		DataSize:    Order.Uint32(b[6:10]),
+		HeaderHash:  b[10 : 10+checksumSize],
+		ArchiveHash: b[10+checksumSize : trailerBodySize],
+	}
+	if version == FormatVersionEncrypted {
+		t.Encryption, err = encryptionFromBinary(b[trailerBodySize:bodySize])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	expected := int64(t.DataSize) + int64(t.HeaderSize) + l
+	if expected != size {
+		return nil, fmt.Errorf("%w: archive size is %d bytes, expected %d bytes", ErrCorrupted, size, expected)
+	}
+
+	return t, nil
+}
+
+// readLegacyTrailer will parse the size of the packed header, which ends
+// the legacy archive
+func readLegacyTrailer(tail []byte, size int64) (*Trailer, error) {
+	headerSize := int64(Order.Uint32(tail))
+	dataSize := size - legacyTrailerSize - headerSize
+	if headerSize == 0 || dataSize < 0 || dataSize > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: not a jrepack archive or unsupported archive version", ErrCorrupted)
+	}
+	return &Trailer{
+		Version:    FormatVersionLegacy,
+		HeaderSize: uint32(headerSize),
+		DataSize:   uint32(dataSize),
+	}, nil
+}
+
+// Encrypt will mark the archive as encrypted with the given parameters
+func (t *Trailer) Encrypt(e *Encryption) {
+	t.Version = FormatVersionEncrypted
+	t.Encryption = e
+}
+
+// Key will derive the archive key from the password.
+// Nil key is returned for the archive, which is not encrypted.
+func (t *Trailer) Key(password string) (*Key, error) {
+	if t.Encryption == nil {
+		return nil, nil
+	}
+	return t.Encryption.Key(password)
+}
+
+// Size is the number of bytes of the binary trailer
+func (t *Trailer) Size() int64 {
+	return int64(len(t.ToBinary()))
+}
+
+// HeaderOffset is the position of the packed header in archive file
+func (t *Trailer) HeaderOffset() int64 {
+	return int64(t.DataSize)
+}
+
+// VerifyHeader will compare checksum of the packed header with the trailer one.
+// Legacy archive has no checksums, so it is not checked.
+func (t *Trailer) VerifyHeader(header []byte) error {
+	if t.Version == FormatVersionLegacy {
+		return nil
+	}
+	hash := sha256.Sum256(header)
+	if !hmac.Equal(hash[:], t.HeaderHash) {
+		return fmt.Errorf("%w: header checksum mismatch", ErrCorrupted)
+	}
+	return nil
+}
+
+// Seal will calculate checksum of the data segments and packed header,
+// already written into archive.
+func (t *Trailer) Seal(r io.ReaderAt) error {
+	hash, err := Checksum(r, int64(t.DataSize)+int64(t.HeaderSize))
+	if err != nil {
+		return err
+	}
+	t.ArchiveHash = hash
+	return nil
+}
+
+// VerifyArchive will compare checksum of the data segments and packed header
+// with the trailer one. Legacy archive has no checksums, so it is not checked.
+func (t *Trailer) VerifyArchive(r io.ReaderAt) error {
+	if t.Version == FormatVersionLegacy {
+		return nil
+	}
+	hash, err := Checksum(r, int64(t.DataSize)+int64(t.HeaderSize))
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(hash, t.ArchiveHash) {
+		return fmt.Errorf("%w: archive checksum mismatch", ErrCorrupted)
+	}
+	return nil
+}
+
+// Checksum will calculate sha256 of the first n bytes of the archive
+func Checksum(r io.ReaderAt, n int64) ([]byte, error) {
+	h := sha256.New()
+	_, err := io.CopyN(h, io.NewSectionReader(r, 0, n), n)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read archive: %v", err)
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestReadTrailer(T *testing.T) {
+	header := []byte("header")
+	data := []byte("some data and header")
+	trailer := NewTrailer(uint32(len(data)), header)
+	data = append(data, header...)
+	err := trailer.Seal(bytes.NewReader(data))
+	if err != nil {
+		T.Fatal(err)
+	}
+	data = append(data, trailer.ToBinary()...)
+
+	t, err := ReadTrailer(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		T.Fatal(err)
+	}
+	if t.Version != FormatVersion {
+		T.Errorf("Unexpected version %d", t.Version)
+	}
+	if t.HeaderSize != 6 || t.HeaderOffset() != 20 {
+		T.Errorf("Unexpected header size %d and offset %d", t.HeaderSize, t.HeaderOffset())
+	}
+	if t.Size() != int64(len(t.ToBinary())) {
+		T.Errorf("Unexpected trailer size %d", t.Size())
+	}
+	if err := t.VerifyHeader(header); err != nil {
+		T.Error(err)
+	}
+	if err := t.VerifyArchive(bytes.NewReader(data)); err != nil {
+		T.Error(err)
+	}
+
+	if err := t.VerifyHeader([]byte("HEADER")); !errors.Is(err, ErrCorrupted) {
+		T.Errorf("Damaged header accepted: %v", err)
+	}
+	data[3] = 'E'
+	if err := t.VerifyArchive(bytes.NewReader(data)); !errors.Is(err, ErrCorrupted) {
+		T.Errorf("Damaged archive accepted: %v", err)
+	}
+}
+
+func TestReadTruncatedTrailer(T *testing.T) {
+	data := append([]byte("some data and header"), NewTrailer(14, []byte("header")).ToBinary()...)
+
+	// truncated, extended and cut in the middle of the trailer
+	cases := [][]byte{
+		data[1:],
+		append([]byte{0}, data...),
+		data[:len(data)-1],
+	}
+	for _, c := range cases {
+		_, err := ReadTrailer(bytes.NewReader(c), int64(len(c)))
+		if !errors.Is(err, ErrCorrupted) {
+			T.Errorf("Invalid archive of %d bytes accepted: %v", len(c), err)
+		}
+	}
+}
+
+func TestReadInvalidTrailer(T *testing.T) {
+	cases := [][]byte{
+		{},
+		[]byte("JRPK"),
+		[]byte("some data without trailer"),
+		append([]byte{0, 0, 0, 200}, []byte(TrailerMagic)...),
+	}
+	for _, data := range cases {
+		_, err := ReadTrailer(bytes.NewReader(data), int64(len(data)))
+		if err == nil {
+			T.Errorf("Invalid trailer accepted: %v", data)
+		}
+	}
+}
+
+func TestReadLegacyTrailer(T *testing.T) {
+	// legacy archive is ended by the size of the packed header
+	data := append([]byte("some data and header"), 0, 0, 0, 6)
+
+	t, err := ReadTrailer(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		T.Fatal(err)
+	}
+	if t.Version != FormatVersionLegacy || t.HeaderSize != 6 || t.HeaderOffset() != 14 || t.Size() != 4 {
+		T.Errorf("Unexpected legacy trailer %+v", t)
+	}
+	if err := t.VerifyArchive(bytes.NewReader(data)); err != nil {
+		T.Error(err)
+	}
+
+	data[len(data)-1] = 100
+	if _, err := ReadTrailer(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrCorrupted) {
+		T.Errorf("Oversized legacy header accepted: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError is the list of the problems, found in the header
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrCorrupted, strings.Join(e.Problems, "; "))
+}
+
+// Unwrap makes ValidationError the ErrCorrupted
+func (e *ValidationError) Unwrap() error {
+	return ErrCorrupted
+}
+
+func (e *ValidationError) problem(format string, a ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, a...))
+}
+
+/*
+Validate will check references of the header records: parents of the folder
+records are in range and have no cycles, data references point to the existing
+data records, data records and segments cover the whole data.
+*/
+func (h *Header) Validate() error {
+	e := &ValidationError{}
+	h.validateFolders(e)
+	h.validateData(e)
+	if len(e.Problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+func (h *Header) validateFolders(e *ValidationError) {
+	data := make(map[uint32]bool, len(h.Data))
+	for _, d := range h.Data {
+		data[d.Offset] = true
+	}
+
+	foldersNum := uint32(len(h.Folders))
+	cycled := h.cycles()
+	for i, folder := range h.Folders {
+		id := uint32(i + 1)
+		name := string(folder.Name)
+
+		if int(folder.Namelength) != len(folder.Name) {
+			e.problem("Folder record %d (%s) has wrong name length %d", id, name, folder.Namelength)
+		}
+
+		switch {
+		case folder.Parent > foldersNum:
+			e.problem("Folder record %d (%s) refers to missing parent %d", id, name, folder.Parent)
+			continue
+		case folder.Parent == id:
+			e.problem("Folder record %d (%s) is the parent of itself", id, name)
+			continue
+		case folder.Parent > 0 && h.Folders[folder.Parent-1].Flags == FData:
+			e.problem("Folder record %d (%s) has the file as the parent", id, name)
+		}
+
+		if cycled[i] {
+			e.problem("Folder record %d (%s) has the looped parents chain", id, name)
+			continue
+		}
+
+		switch folder.Flags {
+		case FData:
+			if folder.Data != NoData && !data[folder.Data] {
+				e.problem("File %s refers to missing data at offset %d", h.FullPath(id), folder.Data)
+			}
+		case FFolder, FArchive:
+			if folder.Data != NoData {
+				e.problem("Folder %s refers to data at offset %d", h.FullPath(id), folder.Data)
+			}
+		default:
+			e.problem("Folder record %d (%s) has unknown flags %d", id, name, folder.Flags)
+		}
+	}
+
+}
+
+// cycles will mark folder records, which parents chain is looped
+func (h *Header) cycles() []bool {
+	const (
+		unknown = iota
+		visiting
+		rooted
+		looped
+	)
+	foldersNum := uint32(len(h.Folders))
+	state := make([]uint8, foldersNum)
+	path := make([]uint32, 0)
+	for i := range h.Folders {
+		path = path[:0]
+		result := uint8(rooted)
+		for id := uint32(i + 1); ; id = h.Folders[id-1].Parent {
+			if id == 0 || id > foldersNum {
+				break
+			}
+			if state[id-1] == visiting {
+				result = looped
+				break
+			}
+			if state[id-1] != unknown {
+				result = state[id-1]
+				break
+			}
+			state[id-1] = visiting
+			path = append(path, id)
+		}
+		for _, id := range path {
+			state[id-1] = result
+		}
+	}
+
+	cycled := make([]bool, foldersNum)
+	for i, st := range state {
+		cycled[i] = st == looped
+	}
+	return cycled
+}
+
+// validateData will check, that segments and data records are sorted and
+// do not overlap, every data record is placed inside of the segment
+func (h *Header) validateData(e *ValidationError) {
+	end := uint64(0)
+	for i, s := range h.Segments {
+		if uint64(s.Offset) < end {
+			e.problem("Segment %d at offset %d overlaps the previous one", i, s.Offset)
+		}
+		end = uint64(s.Offset) + uint64(s.Size)
+	}
+
+	end = 0
+	next := 0
+	for _, d := range h.Data {
+		if uint64(d.Offset) < end {
+			e.problem("Data at offset %d overlaps the previous one", d.Offset)
+		}
+		end = uint64(d.Offset) + uint64(d.Size)
+		if d.Size == 0 {
+			continue
+		}
+
+		for next < len(h.Segments) && uint64(h.Segments[next].Offset)+uint64(h.Segments[next].Size) <= uint64(d.Offset) {
+			next++
+		}
+		if next == len(h.Segments) || d.Offset < h.Segments[next].Offset ||
+			end > uint64(h.Segments[next].Offset)+uint64(h.Segments[next].Size) {
+			e.problem("Data at offset %d is not inside of the segment", d.Offset)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lzma
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+// sample is the compressible data with the long distance matches
+func sample() []byte {
+	var b bytes.Buffer
+	for i := 0; i < 20000; i++ {
+		b.WriteString("java/lang/Object")
+		b.WriteByte(byte(i * 7))
+		b.WriteByte(byte(i >> 3))
+	}
+	return b.Bytes()
+}
+
+func encode(T *testing.T, data []byte) []byte {
+	var b bytes.Buffer
+	w := NewWriterLevel(&b, 8)
+	_, err := w.Write(data)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		T.Error(err)
+	}
+	return b.Bytes()
+}
+
+/*
+TestConcurrentEncoders tests, that the encoders, running at the same time,
+write the same stream as the single encoder. Run with -race to check, that they
+share no state.
+*/
+func TestConcurrentEncoders(T *testing.T) {
+	data := sample()
+	expected := encode(T, data)
+	r := NewReader(bytes.NewReader(expected))
+	decoded, err := ioutil.ReadAll(r)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if !bytes.Equal(decoded, data) {
+		T.Fatal("Data is not restored")
+	}
+
+	results := make([][]byte, 4)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = encode(T, data)
+		}(i)
+	}
+	wg.Wait()
+	for i, result := range results {
+		if !bytes.Equal(result, expected) {
+			T.Errorf("Encoder %d wrote %d bytes, expected %d bytes", i, len(result), len(expected))
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package packer
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/alexript/jrepack/internal/pkg/bcj"
+	"github.com/alexript/jrepack/internal/pkg/codec"
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+// categories of the blobs for the automatic codec selection
+const (
+	categoryOther = iota
+	categoryNative
+	categoryMedia
+	categoryCount
+)
+
+const (
+	// DefaultAutoBudget is the default time budget of the codec selection for one data segment
+	DefaultAutoBudget = 5 * time.Second
+
+	autoSegmentSize = 8 * 1024 * 1024
+)
+
+// magic numbers of the already compressed files
+var mediaMagics = [][]byte{
+	[]byte("\x89PNG"),
+	[]byte("\xFF\xD8\xFF"),
+	[]byte("GIF8"),
+	[]byte("\x1F\x8B"),
+	[]byte("PK\x03\x04"),
+	[]byte("BZh"),
+	[]byte("\xFD7zXZ"),
+	[]byte("OggS"),
+	[]byte("ID3"),
+}
+
+// variant is the codec with the optional branch filter, tried for the data segment
+type variant struct {
+	codec  uint8
+	filter bool
+}
+
+func category(data []byte) int {
+	if bcj.Detect(data) != bcj.None {
+		return categoryNative
+	}
+	for _, m := range mediaMagics {
+		if bytes.HasPrefix(data, m) {
+			return categoryMedia
+		}
+	}
+	return categoryOther
+}
+
+// variants will return codecs for the category, ordered by the expected profit
+func variants(cat int) []variant {
+	switch cat {
+	case categoryNative:
+		return []variant{{common.CodecLZMA, true}, {common.CodecLZMA, false}, {common.CodecDeflate, false}}
+	case categoryMedia:
+		return []variant{{common.CodecDeflate, false}, {common.CodecLZMA, false}}
+	}
+	return []variant{{common.CodecLZMA, false}, {common.CodecDeflate, false}}
+}
+
+/*
+selectCodec will compress data with all variants and return the smallest result.
+Filtered data is used for the variants with branch filter.
+
+Next variant is not tried after the time budget is exceeded. Uncompressed data
+is used, if no variant makes data smaller.
+*/
+func selectCodec(data []byte, filtered []byte, vs []variant, budget time.Duration) (variant, []byte, error) {
+	best := variant{codec: common.CodecStore}
+	result := data
+	deadline := time.Now().Add(budget)
+
+	for i, v := range vs {
+		if i > 0 && time.Now().After(deadline) {
+			break
+		}
+		input := data
+		if v.filter {
+			if filtered == nil {
+				continue
+			}
+			input = filtered
+		}
+		encoded, err := codec.Encode(v.codec, input, nil)
+		if err != nil {
+			return best, nil, err
+		}
+		if len(encoded) < len(result) {
+			best = v
+			result = encoded
+		}
+	}
+	return best, result, nil
+}
+
+func (options *Options) autoBudget() time.Duration {
+	if options.AutoBudget > 0 {
+		return options.AutoBudget
+	}
+	return DefaultAutoBudget
+}
+
+// compressAuto will write the pending blobs of the category as the data
+// segment, compressed by the best codec
+func (o *Output) compressAuto(cat int) error {
+	p := &o.auto[cat]
+	if len(p.blobs) == 0 {
+		return nil
+	}
+
+	data := bytes.Join(p.blobs, nil)
+	var filtered []byte
+	if cat == categoryNative {
+		filtered = make([]byte, 0, len(data))
+		for _, blob := range p.blobs {
+			f := append([]byte(nil), blob...)
+			bcj.Encode(bcj.Detect(f), f)
+			filtered = append(filtered, f...)
+		}
+	}
+
+	v, encoded, err := selectCodec(data, filtered, variants(cat), o.Options.autoBudget())
+	if err != nil {
+		return err
+	}
+	return o.writeSegment(p, v.codec, common.TransformNone, encoded, v.filter)
+}
@@ -20,74 +20,375 @@
 package packer
 
 import (
-	"errors"
+	"bytes"
+	"context"
 	"io"
-	"os"
 	"runtime"
 
+	"github.com/alexript/jrepack/internal/pkg/bcj"
+	"github.com/alexript/jrepack/internal/pkg/classfile"
+	"github.com/alexript/jrepack/internal/pkg/codec"
+	common "github.com/alexript/jrepack/internal/pkg/common"
 	"github.com/alexript/jrepack/ui"
-	"github.com/itchio/lzma"
 )
 
 // Output is container for lzma writer object
 type Output struct {
-	File   *os.File
-	Writer io.WriteCloser
+	File    io.Writer
+	Writer  io.WriteCloser
+	Options Options
+
+	counter    *countWriter
+	sealer     io.WriteCloser
+	encryption *common.Encryption
+	key        *common.Key
+	segment    *common.SegmentRecord
+	segments   common.SegmentsHeader
+	dictionary []byte
+	classes    pending
+	small      pending
+	auto       [categoryCount]pending
+	written    uint32
+	catalog    *common.Catalog
+	ui         ui.JrepackUI
+}
+
+// pending is the list of the blobs, which are written on output close
+type pending struct {
+	blobs  [][]byte
+	hashes [][]byte
+	size   int
+}
+
+func (p *pending) add(data []byte, hash []byte) {
+	p.blobs = append(p.blobs, data)
+	p.hashes = append(p.hashes, hash)
+	p.size += len(data)
+}
+
+// split will group the pending blobs by the given size, every group has at
+// least one blob
+func (p *pending) split(size int) []pending {
+	var groups []pending
+	for i := 0; i < len(p.blobs); {
+		var group pending
+		for ; i < len(p.blobs) && (len(group.blobs) == 0 || group.size+len(p.blobs[i]) <= size); i++ {
+			group.add(p.blobs[i], p.hashes[i])
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// countWriter counts bytes, written into the archive file
+type countWriter struct {
+	w io.Writer
+	n uint32
 }
 
-var (
-	o           *Output
-	writtensize uint32
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += uint32(n)
+	return n, err
+}
+
+const (
+	smallFileSize = 32 * 1024
+	frameSize     = 64 * 1024
+	blockSize     = 1024 * 1024
+	sampleSize    = 4 * 1024 * 1024
 )
 
-func openOutput(filename string) (*Output, error) {
-	if o != nil {
-		return nil, errors.New("Output already open")
+// openOutput will start writing of the data segments into w
+func openOutput(w io.Writer, options Options) (*Output, error) {
+	o := &Output{
+		File:     w,
+		Options:  options,
+		segments: make(common.SegmentsHeader, 0),
+		catalog:  common.NewCatalog(),
+		ui:       options.progress(),
 	}
-	output, err := os.Create(filename)
+
+	var err error
+	if options.Password != "" {
+		o.encryption, err = common.NewEncryption()
+		if err == nil {
+			o.key, err = o.encryption.Key(options.Password)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+
+}
+
+// beginSegment will start new compressed stream for the next data segment
+func (o *Output) beginSegment(codecID uint8, transform uint8) error {
+	o.counter = &countWriter{w: o.File}
+	var cw io.Writer = o.counter
+	o.sealer = nil
+	if o.key != nil {
+		o.sealer = o.key.Writer(o.counter, uint32(len(o.segments)))
+		cw = o.sealer
+	}
+	w, err := codec.NewWriter(codecID, cw, o.dictionary)
 	if err != nil {
-		o = nil
-		return nil, err
+		return err
+	}
+	o.Writer = w
+	o.segment = &common.SegmentRecord{
+		Offset:    o.written,
+		Codec:     codecID,
+		Transform: transform,
 	}
+	return nil
+}
 
-	w := lzma.NewWriterLevel(output, 8)
+// endSegment will close the compressed stream of the current data segment
+func (o *Output) endSegment() error {
+	if o.segment == nil {
+		return nil
+	}
+	err := o.Writer.Close()
+	if o.sealer != nil {
+		if e := o.sealer.Close(); err == nil {
+			err = e
+		}
+		o.sealer = nil
+	}
+	o.segment.Size = o.written - o.segment.Offset
+	o.segment.Packed = o.counter.n
+	o.segments = append(o.segments, o.segment)
+	o.segment = nil
+	o.Writer = nil
+	return err
+}
 
-	o = &Output{
-		File:   output,
-		Writer: w,
+// compress will write the data of the new hash summ. Big data is written by
+// blocks, context is checked before every block.
+func (o *Output) compress(ctx context.Context, data []byte, hash []byte) error {
+	if o.Options.ClassTransform && classfile.IsClass(data) {
+		// all classes are grouped and written on output close
+		o.classes.add(data, hash)
+		return nil
 	}
-	writtensize = 0
 
-	return o, nil
+	if o.Options.Dictionary && len(data) < smallFileSize {
+		// small files are written on output close, when dictionary is ready
+		o.small.add(data, hash)
+		return nil
+	}
+
+	if o.Options.Auto {
+		// blobs of the same category are grouped into the data segments
+		cat := category(data)
+		o.auto[cat].add(data, hash)
+		if o.auto[cat].size >= autoSegmentSize {
+			return o.compressAuto(cat)
+		}
+		return nil
+	}
+
+	if o.segment == nil {
+		err := o.beginSegment(common.CodecLZMA, common.TransformNone)
+		if err != nil {
+			return err
+		}
+	}
+
+	l := len(data)
+	offset := o.written
+
+	if o.Options.BranchFilter {
+		if filter := bcj.Detect(data); filter != bcj.None {
+			filtered := make([]byte, l)
+			copy(filtered, data)
+			bcj.Encode(filter, filtered)
+			o.catalog.SetFilter(offset, filter)
+			data = filtered
+		}
+	}
+
+	for len(data) > 0 {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		n := len(data)
+		if n > blockSize {
+			n = blockSize
+		}
+		_, err = o.Writer.Write(data[:n])
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	o.written = o.written + uint32(l)
+	o.catalog.SetOffset(offset, hash)
 
+	o.ui.Compress(ui.Compressed{
+		Len:   l,
+		Total: o.written,
+	})
+	return nil
 }
 
-func compress(data []byte) (uint32, int, error) {
-	if o != nil {
-		l := len(data)
-		offset := writtensize
-		n, err := o.Writer.Write(data)
-		if err == nil {
-			writtensize = writtensize + uint32(l)
+// compressSmall will write small files as the frames, compressed with dictionary.
+// Frames are kept, when they are smaller together with the dictionary than the
+// LZMA segments of the same files. LZMA segments are limited by the size of
+// the auto codec segments, so reading of the small file does not decode all
+// small files of the archive. Context is checked before every frame and segment.
+func (o *Output) compressSmall(ctx context.Context) error {
+	blobs := o.small.blobs
+	if len(blobs) == 0 {
+		return nil
+	}
+
+	// every n-th file is the sample for dictionary
+	step := o.small.size/sampleSize + 1
+	samples := make([][]byte, 0, len(blobs)/step+1)
+	for i := 0; i < len(blobs); i += step {
+		samples = append(samples, blobs[i])
+	}
+	dictionary := codec.Train(samples, codec.DictionarySize)
+
+	frames := o.small.split(frameSize)
+	encoded := make([][]byte, len(frames))
+	packed := len(dictionary)
+	for i, frame := range frames {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		encoded[i], err = codec.Encode(common.CodecDeflateDict, bytes.Join(frame.blobs, nil), dictionary)
+		if err != nil {
+			return err
+		}
+		packed += len(encoded[i])
+	}
 
-			ui.Current().Compress(ui.Compressed{
-				Len:   l,
-				Total: writtensize,
-			})
+	segments := o.small.split(autoSegmentSize)
+	compressed := make([][]byte, len(segments))
+	lzmaPacked := 0
+	for i, segment := range segments {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		compressed[i], err = codec.Encode(common.CodecLZMA, bytes.Join(segment.blobs, nil), nil)
+		if err != nil {
+			return err
 		}
+		lzmaPacked += len(compressed[i])
+	}
 
-		return offset, n, err
+	codecID := common.CodecLZMA
+	if lzmaPacked > packed {
+		o.dictionary = dictionary
+		codecID = common.CodecDeflateDict
+		segments, compressed = frames, encoded
 	}
-	return 0, 0, nil
+	for i := range segments {
+		err := o.writeSegment(&segments[i], codecID, common.TransformNone, compressed[i], false)
+		if err != nil {
+			return err
+		}
+	}
+	o.small = pending{}
+	return nil
 }
 
-func closeOutput() uint32 {
-	if o != nil {
-		_ = o.Writer.Close()
+// compressClasses will write all grouped classes as the single data segment
+func (o *Output) compressClasses() error {
+	if len(o.classes.blobs) == 0 {
+		return nil
+	}
 
-		_ = o.File.Close()
-		o = nil
-		runtime.GC()
+	var err error
+	encoded := classfile.Encode(o.classes.blobs)
+	codecID := common.CodecLZMA
+	if o.Options.Auto {
+		var v variant
+		v, encoded, err = selectCodec(encoded, nil, variants(categoryOther), o.Options.autoBudget())
+		codecID = v.codec
+	} else {
+		encoded, err = codec.Encode(codecID, encoded, nil)
 	}
-	return writtensize
+	if err != nil {
+		return err
+	}
+
+	return o.writeSegment(&o.classes, codecID, common.TransformClass, encoded, false)
+}
+
+// writeSegment will write already compressed data segment of the pending blobs
+func (o *Output) writeSegment(p *pending, codecID uint8, transform uint8, encoded []byte, filtered bool) error {
+	if o.key != nil {
+		encoded = o.key.Seal(uint32(len(o.segments)), encoded)
+	}
+	segment := &common.SegmentRecord{
+		Offset:    o.written,
+		Packed:    uint32(len(encoded)),
+		Codec:     codecID,
+		Transform: transform,
+	}
+	for i, blob := range p.blobs {
+		o.catalog.SetOffset(o.written, p.hashes[i])
+		if filtered {
+			if filter := bcj.Detect(blob); filter != bcj.None {
+				o.catalog.SetFilter(o.written, filter)
+			}
+		}
+		o.written = o.written + uint32(len(blob))
+	}
+	segment.Size = o.written - segment.Offset
+
+	_, err := o.File.Write(encoded)
+	if err != nil {
+		return err
+	}
+	o.segments = append(o.segments, segment)
+
+	o.ui.Compress(ui.Compressed{
+		Len:   p.size,
+		Total: o.written,
+	})
+	*p = pending{}
+	return nil
+}
+
+// closeOutput will write all pending data and fill data size, segments and
+// dictionary of the archive header. Output writer is not closed. Pending data
+// is not written, when the context is done, but the open segment is closed.
+func (o *Output) closeOutput(ctx context.Context, h *common.Header) error {
+	err := o.endSegment()
+	if err == nil {
+		err = o.compressSmall(ctx)
+	}
+	for cat := range o.auto {
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil {
+			err = o.compressAuto(cat)
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = o.compressClasses()
+	}
+	if h != nil {
+		h.Size = o.written
+		h.Segments = o.segments
+		h.Dictionary = o.dictionary
+	}
+
+	runtime.GC()
+
+	return err
 }
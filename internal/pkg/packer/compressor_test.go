@@ -21,35 +21,55 @@ package packer
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	common "github.com/alexript/jrepack/internal/pkg/common"
-	"github.com/itchio/lzma"
+	"github.com/alexript/jrepack/internal/pkg/lzma"
 )
 
 func TestSimplecompress(T *testing.T) {
 	filename := "../../../test/output/simplecompress.dat"
 	fd, _ := filepath.Abs(filename)
 	defer os.Remove(fd)
-	output, err := openOutput(filename)
+	f, err := os.Create(fd)
+	if err != nil {
+		T.Fatal(err)
+	}
+	output, err := openOutput(f, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
 
 	inputFolder := `../../../test/testdata/simplefolder`
-	_, _, err = readInputFolder(inputFolder)
+	_, _, err = output.readInputFolder(context.Background(), inputFolder)
 
 	T.Logf("Output struct: %v", output)
-	written := closeOutput()
+	h := common.NewHeader(0)
+	cerr := output.closeOutput(context.Background(), h)
+	f.Close()
+	written := h.Size
+	segments := h.Segments
 
 	T.Logf("Output file size: %d", written)
 	if err != nil {
 		T.Fatal(err)
 	}
+	if cerr != nil {
+		T.Fatal(cerr)
+	}
+	if len(segments) != 1 {
+		T.Errorf("Unexpected number of segments %d", len(segments))
+	}
 
-	T.Logf("Offsets table: %v", common.GetOffsets())
+	T.Logf("Offsets table: %v", output.catalog.Offsets)
 
-	f, err := os.Open(filename)
+	f, err = os.Open(filename)
 	defer f.Close()
 	if err != nil {
 		T.Fatal(err)
@@ -65,3 +85,89 @@ func TestSimplecompress(T *testing.T) {
 	}
 
 }
+
+func TestSelectCodec(T *testing.T) {
+	text := bytes.Repeat([]byte("compressible text "), 1024)
+	v, encoded, err := selectCodec(text, nil, variants(categoryOther), time.Minute)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if v.codec == common.CodecStore || len(encoded) >= len(text) {
+		T.Errorf("Text is not compressed: codec %d, size %d", v.codec, len(encoded))
+	}
+
+	random := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+	v, encoded, err = selectCodec(random, nil, variants(categoryMedia), time.Minute)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if v.codec != common.CodecStore || !bytes.Equal(encoded, random) {
+		T.Errorf("Random data is not stored: codec %d", v.codec)
+	}
+
+	// only the first variant is tried, when budget is exceeded
+	v, _, err = selectCodec(text, nil, []variant{{common.CodecDeflate, false}, {common.CodecLZMA, false}}, -time.Second)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if v.codec != common.CodecDeflate {
+		T.Errorf("Unexpected codec %d", v.codec)
+	}
+}
+
+func TestDictionaryRatio(T *testing.T) {
+	for _, dir := range []string{"", "classfiles", "mixedfolder", "zerosize"} {
+		inputFolder := "../../../test/testdata/" + dir
+		var plain, dict bytes.Buffer
+		err := PackTo(context.Background(), inputFolder, &plain, Options{})
+		if err != nil {
+			T.Fatal(err)
+		}
+		err = PackTo(context.Background(), inputFolder, &dict, Options{Dictionary: true})
+		if err != nil {
+			T.Fatal(err)
+		}
+		if dict.Len() > plain.Len() {
+			T.Errorf("Dictionary archive of %s is %d bytes, default one is %d bytes", inputFolder, dict.Len(), plain.Len())
+		}
+	}
+}
+
+func TestSmallSegments(T *testing.T) {
+	var b bytes.Buffer
+	output, err := openOutput(&b, Options{Dictionary: true})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	// repeated text is smaller as LZMA segments, than as dictionary frames
+	text := bytes.Repeat([]byte("small file of the repeated text "), 900)
+	total := 0
+	for i := 0; total <= autoSegmentSize; i++ {
+		err = output.compress(context.Background(), text, []byte{byte(i), byte(i >> 8)})
+		if err != nil {
+			T.Fatal(err)
+		}
+		total += len(text)
+	}
+
+	h := common.NewHeader(0)
+	err = output.closeOutput(context.Background(), h)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if len(h.Segments) < 2 || h.Dictionary != nil {
+		T.Fatalf("Unexpected %d segments, dictionary %d bytes", len(h.Segments), len(h.Dictionary))
+	}
+	size := uint32(0)
+	for _, s := range h.Segments {
+		if s.Codec != common.CodecLZMA || s.Offset != size || s.Size > autoSegmentSize {
+			T.Errorf("Unexpected segment %v", s)
+		}
+		size += s.Size
+	}
+	if size != uint32(total) || h.Size != size {
+		T.Errorf("Unexpected data size %d of %d", size, total)
+	}
+}
@@ -21,6 +21,7 @@ package packer
 
 import (
 	"archive/zip"
+	"context"
 	"errors"
 	"io/ioutil"
 	"os"
@@ -28,12 +29,13 @@ import (
 	"runtime"
 
 	common "github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/ui"
 )
 
 /*
 readInputFolder is entry point of inputreader.
 */
-func readInputFolder(inputFolder string) (*common.Dirinfo, *common.Folder, error) {
+func (o *Output) readInputFolder(ctx context.Context, inputFolder string) (*common.Dirinfo, *common.Folder, error) {
 	runtime.GC()
 	absPath, err := filepath.Abs(inputFolder)
 	if err != nil {
@@ -50,20 +52,19 @@ func readInputFolder(inputFolder string) (*common.Dirinfo, *common.Folder, error
 		return nil, nil, errors.New(absPath + " is not folder")
 	}
 
-	common.ClearDirinfo()
-	rootfolder := common.NewFolder("_root_", false)
-	err = walkInputTree(absPath, &rootfolder)
+	rootfolder := o.newFolder("_root_", false)
+	err = o.walkInputTree(ctx, absPath, &rootfolder)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return common.GetDirinfo(), &rootfolder, nil
+	return &o.catalog.Dirinfo, &rootfolder, nil
 }
 
 /*
-walkInputTree is recursive walker
+walkInputTree is recursive walker, context is checked before every file
 */
-func walkInputTree(dirname string, parent *common.Folder) error {
+func (o *Output) walkInputTree(ctx context.Context, dirname string, parent *common.Folder) error {
 	files, err := ioutil.ReadDir(dirname)
 	if err != nil {
 		return err
@@ -74,15 +75,19 @@ func walkInputTree(dirname string, parent *common.Folder) error {
 	}
 
 	for _, fi := range files {
+		err = ctx.Err()
+		if err != nil {
+			return err
+		}
 		name := fi.Name()
 		fullname := filepath.Join(dirname, name)
 		if fi.IsDir() {
-			subfolder := common.NewFolder(name, false)
+			subfolder := o.newFolder(name, false)
 			err = common.AddFolderToFolder(parent, &subfolder)
 			if err != nil {
 				return err
 			}
-			err = walkInputTree(fullname, &subfolder)
+			err = o.walkInputTree(ctx, fullname, &subfolder)
 			if err != nil {
 				return err
 			}
@@ -91,9 +96,9 @@ func walkInputTree(dirname string, parent *common.Folder) error {
 			_, isContainer := common.IsContainer(fullname)
 
 			if isContainer {
-				subfolder := common.NewFolder(name, true)
+				subfolder := o.newFolder(name, true)
 
-				err = readContainer(&subfolder, fullname)
+				err = o.readContainer(ctx, &subfolder, fullname)
 				if err != nil {
 					return err
 				}
@@ -108,7 +113,7 @@ func walkInputTree(dirname string, parent *common.Folder) error {
 				if err != nil {
 					return err
 				}
-				file, isNewHash := common.NewFile(name, fileData)
+				file, isNewHash := o.newFile(name, fileData)
 				err = common.AddFileToFolder(parent, file)
 				if err != nil {
 					return err
@@ -116,11 +121,10 @@ func walkInputTree(dirname string, parent *common.Folder) error {
 				if isNewHash {
 
 					if len(fileData) > 0 {
-						offset, _, err := compress(fileData)
+						err = o.compress(ctx, fileData, file.Hashsum)
 						if err != nil {
 							return err
 						}
-						common.SetOffset(uint32(offset), file.Hashsum)
 					}
 
 				}
@@ -132,9 +136,9 @@ func walkInputTree(dirname string, parent *common.Folder) error {
 }
 
 /*
-readContainer is recursive zip-file reader
+readContainer is recursive zip-file reader, context is checked before every entry
 */
-func readContainer(container *common.Folder, filename string) error {
+func (o *Output) readContainer(ctx context.Context, container *common.Folder, filename string) error {
 	r, err := zip.OpenReader(filename)
 	if err != nil {
 		return err
@@ -159,7 +163,7 @@ func readContainer(container *common.Folder, filename string) error {
 		}()
 
 		if f.FileInfo().IsDir() {
-			folder := common.NewFolder(f.Name, false)
+			folder := o.newFolder(f.Name, false)
 			err = common.AddFolderToFolder(container, &folder)
 			if err != nil {
 				return err
@@ -173,7 +177,7 @@ func readContainer(container *common.Folder, filename string) error {
 				return err
 			}
 
-			file, isNewHash := common.NewFile(f.Name, fileData)
+			file, isNewHash := o.newFile(f.Name, fileData)
 			err = common.AddFileToFolder(container, file)
 			if err != nil {
 				return err
@@ -181,11 +185,10 @@ func readContainer(container *common.Folder, filename string) error {
 			if isNewHash {
 
 				if len(fileData) > 0 {
-					offset, _, err := compress(fileData)
+					err = o.compress(ctx, fileData, file.Hashsum)
 					if err != nil {
 						return err
 					}
-					common.SetOffset(uint32(offset), file.Hashsum)
 				}
 			}
 
@@ -194,7 +197,11 @@ func readContainer(container *common.Folder, filename string) error {
 	}
 
 	for _, f := range r.File {
-		err := extractAndWriteFile(f)
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		err = extractAndWriteFile(f)
 		if err != nil {
 			return err
 		}
@@ -202,3 +209,27 @@ func readContainer(container *common.Folder, filename string) error {
 
 	return nil
 }
+
+// newFolder will create new Folder object
+func (o *Output) newFolder(foldername string, isContainer bool) common.Folder {
+	folder := common.NewFolder(foldername, isContainer)
+	o.ui.NewFolder(ui.Folder{
+		IsContainer: isContainer,
+		Name:        folder.Name,
+	})
+	return folder
+}
+
+// newFile will create new File object and add it into the catalog, true is
+// returned for the first file with this hash summ
+func (o *Output) newFile(filename string, body []byte) (*common.File, bool) {
+	file := common.NewFile(filename, body)
+	isNewHash := o.catalog.AddFile(file)
+	o.ui.Hashed(ui.Hash{
+		File:      filename,
+		Size:      file.Size,
+		Hash:      file.Hashsum,
+		IsNewHash: isNewHash,
+	})
+	return file, isNewHash
+}
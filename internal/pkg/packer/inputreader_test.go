@@ -20,32 +20,49 @@
 package packer
 
 import (
+	"context"
+	"io/ioutil"
 	"testing"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
 )
 
+// readTestInput will read the input folder into the discarded output
+func readTestInput(inputFolder string) (*common.Dirinfo, *common.Folder, error) {
+	o, err := openOutput(ioutil.Discard, Options{})
+	if err != nil {
+		return nil, nil, err
+	}
+	dirinfo, rootFolder, err := o.readInputFolder(context.Background(), inputFolder)
+	if e := o.closeOutput(context.Background(), nil); err == nil {
+		err = e
+	}
+	return dirinfo, rootFolder, err
+}
+
 func TestReadNotexistedInputFolder(T *testing.T) {
-	_, _, err := readInputFolder("./non_existed_folder_name")
+	_, _, err := readTestInput("./non_existed_folder_name")
 	if err == nil {
 		T.Error("Can read non existed input folder")
 	}
 }
 
 func TestReadExistedInputFolder(T *testing.T) {
-	_, _, err := readInputFolder("../packer")
+	_, _, err := readTestInput("../packer")
 	if err != nil {
 		T.Error(err)
 	}
 }
 
 func TestReadInvalidInputFolder(T *testing.T) {
-	_, _, err := readInputFolder(`\\\something`) // this is invalid filename for windows
+	_, _, err := readTestInput(`\\\something`) // this is invalid filename for windows
 	if err == nil {
 		T.Error("Can read invalid input folder")
 	}
 }
 
 func TestReadInputNotFolder(T *testing.T) {
-	_, _, err := readInputFolder("packer.go")
+	_, _, err := readTestInput("packer.go")
 	if err == nil {
 		T.Error("Can read file as input folder")
 	}
@@ -54,7 +71,7 @@ func TestReadInputNotFolder(T *testing.T) {
 func TestReadSimplefolder(T *testing.T) {
 
 	inputFolder := `../../../test/testdata/simplefolder`
-	dirinfo, rootFolder, err := readInputFolder(inputFolder)
+	dirinfo, rootFolder, err := readTestInput(inputFolder)
 	if err != nil || dirinfo == nil {
 		T.Errorf("Unable to read test data from %v", inputFolder)
 	}
@@ -71,7 +88,7 @@ func TestReadSimplefolder(T *testing.T) {
 func TestReadSimplecontainer(T *testing.T) {
 
 	inputFolder := `../../../test/testdata/simplecontainer`
-	dirinfo, rootFolder, err := readInputFolder(inputFolder)
+	dirinfo, rootFolder, err := readTestInput(inputFolder)
 	if err != nil || dirinfo == nil {
 		T.Errorf("Unable to read test data from %v", inputFolder)
 	}
@@ -88,7 +105,7 @@ func TestReadSimplecontainer(T *testing.T) {
 func TestReadNestedcontainer(T *testing.T) {
 
 	inputFolder := `../../../test/testdata/nestedcontainer`
-	dirinfo, rootFolder, err := readInputFolder(inputFolder)
+	dirinfo, rootFolder, err := readTestInput(inputFolder)
 	if err != nil || dirinfo == nil {
 		T.Errorf("Unable to read test data from %v", inputFolder)
 	}
@@ -24,22 +24,91 @@ package packer
 
 import (
 	"bytes"
-	"encoding/binary"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
 	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 
+	"github.com/alexript/jrepack/internal/pkg/codec"
 	common "github.com/alexript/jrepack/internal/pkg/common"
 	"github.com/alexript/jrepack/ui"
-	"github.com/itchio/lzma"
 )
 
+// Options is the set of the packing options
+type Options struct {
+	// DumpHeader will write binary and json header dumps near the output file
+	DumpHeader bool
+
+	// ClassTransform will group java classes and split them into streams
+	ClassTransform bool
+
+	// BranchFilter will apply branch converter to the native executables
+	BranchFilter bool
+
+	// Dictionary will compress small files in the independent frames
+	// with the dictionary, trained on the files sample. Small files are
+	// compressed by LZMA, when the frames are not smaller.
+	Dictionary bool
+
+	// Auto will try several codecs for every data segment and keep the smallest result
+	Auto bool
+
+	// AutoBudget is the time budget of the codec selection for one data segment
+	AutoBudget time.Duration
+
+	// SigningKey will sign the archive by the embedded signature
+	SigningKey ed25519.PrivateKey
+
+	// Password will encrypt the data segments and the header of the archive
+	Password string
+
+	// Metadata is stored in the archive header, so it is covered by the
+	// header checksum and the signature
+	Metadata common.Properties
+
+	// UI receives the progress of the packing, current UI is used when nil
+	UI ui.JrepackUI
+}
+
+// progress will return UI of the packing
+func (options *Options) progress() ui.JrepackUI {
+	if options.UI != nil {
+		return options.UI
+	}
+	return ui.Current()
+}
+
 /*
 Pack is the entry point for package process.
 */
 func Pack(inputFolder, outputFile string, dumpheader bool) error {
-	input, err := filepath.Abs(inputFolder)
+	return PackWithOptions(inputFolder, outputFile, Options{
+		DumpHeader: dumpheader,
+	})
+}
+
+/*
+PackWithOptions is the entry point for package process with the given options.
+*/
+func PackWithOptions(inputFolder, outputFile string, options Options) error {
+	return PackContext(context.Background(), inputFolder, outputFile, options)
+}
+
+/*
+PackContext is PackWithOptions, which is stopped, when the context is done.
+Context is checked between the files and the blocks of the big files. Output
+file and header dumps are removed on failure, so the canceled packing returns
+context error and leaves nothing behind.
+*/
+func PackContext(ctx context.Context, inputFolder, outputFile string, options Options) error {
+	input, err := checkInput(inputFolder)
 	if err != nil {
 		return err
 	}
@@ -48,46 +117,124 @@ func Pack(inputFolder, outputFile string, dumpheader bool) error {
 	if err != nil {
 		return err
 	}
+	_, err = os.Stat(output)
+	if err == nil {
+		return fmt.Errorf("Output file %s exists", output)
+	}
 
-	ifi, err := os.Stat(input)
+	f, err := os.Create(output)
 	if err != nil {
 		return err
 	}
-	if !ifi.IsDir() {
-		return fmt.Errorf("Input folder %s is not the folder", input)
+	dump := ""
+	if options.DumpHeader {
+		dump = output
+	}
+	err = pack(ctx, input, f, options, dump)
+	if e := f.Close(); err == nil {
+		err = e
 	}
+	if err != nil {
+		_ = os.Remove(output)
+		if dump != "" {
+			_ = os.Remove(dump + ".header.json")
+			_ = os.Remove(dump + ".header")
+		}
+	}
+	return err
+}
 
-	_, err = os.Stat(output)
-	if err == nil {
-		return fmt.Errorf("Output file %s exists", output)
+/*
+PackTo will pack the folder into the archive, written into w. Archive checksum
+is calculated while the archive is written, so w is never read or rewound.
+DumpHeader option is ignored, there is no file name for the dumps.
+*/
+func PackTo(ctx context.Context, inputFolder string, w io.Writer, options Options) error {
+	input, err := checkInput(inputFolder)
+	if err != nil {
+		return err
 	}
+	return pack(ctx, input, w, options, "")
+}
 
-	_, err = openOutput(output)
+// checkInput will return absolute path of the input folder
+func checkInput(inputFolder string) (string, error) {
+	input, err := filepath.Abs(inputFolder)
+	if err != nil {
+		return "", err
+	}
 
+	ifi, err := os.Stat(input)
+	if err != nil {
+		return "", err
+	}
+	if !ifi.IsDir() {
+		return "", fmt.Errorf("Input folder %s is not the folder", input)
+	}
+	return input, nil
+}
+
+// archiveWriter counts and hashes the bytes of the data segments and header
+type archiveWriter struct {
+	w    io.Writer
+	hash hash.Hash
+	n    int64
+}
+
+func (a *archiveWriter) Write(p []byte) (int, error) {
+	n, err := a.w.Write(p)
+	a.hash.Write(p[:n])
+	a.n += int64(n)
+	return n, err
+}
+
+// pack will write the archive of the input folder into w. Header dumps are
+// written near the dump file name, when it is not empty.
+func pack(ctx context.Context, input string, w io.Writer, options Options, dump string) error {
+	err := options.Metadata.Validate()
+	if err != nil {
+		return err
+	}
+	err = ctx.Err()
 	if err != nil {
-		closeOutput()
 		return err
 	}
 
-	_, rootfolder, err := readInputFolder(input)
+	aw := &archiveWriter{w: w, hash: sha256.New()}
+	out, err := openOutput(aw, options)
+	if err != nil {
+		return err
+	}
 
-	dataSize := closeOutput()
+	_, rootfolder, err := out.readInputFolder(ctx, input)
 
-	h := common.NewHeader(dataSize)
-	offsets := common.GetOffsets()
+	h := common.NewHeader(0)
+	cerr := out.closeOutput(ctx, h)
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	offsets := &out.catalog.Offsets
 	h.Marshal(rootfolder, offsets)
+	h.ApplyFilters(&out.catalog.Filters)
+	h.Release, err = common.ReadRelease(input)
+	if err != nil {
+		return err
+	}
+	h.Metadata = options.Metadata
 	rootfolder = nil
 	offsets = nil
 	runtime.GC()
 	binHeader := common.ToBinary(h)
 
-	if dumpheader {
-		json, err := os.Create(output + ".header.json")
-		if err != nil {
-			return err
+	if dump != "" {
+		err = ioutil.WriteFile(dump+".header.json", []byte(h.String()), 0666)
+		if err == nil {
+			err = ioutil.WriteFile(dump+".header", binHeader, 0666)
 		}
-		defer json.Close()
-		_, err = json.Write([]byte(h.String()))
 		if err != nil {
 			return err
 		}
@@ -96,55 +243,55 @@ func Pack(inputFolder, outputFile string, dumpheader bool) error {
 	h = nil
 	runtime.GC()
 
-	if dumpheader {
-		dump, err := os.Create(output + ".header")
-		if err != nil {
-			return err
-		}
-		defer dump.Close()
-		_, err = dump.Write(binHeader)
-		if err != nil {
-			return err
-		}
+	err = ctx.Err()
+	if err != nil {
+		return err
 	}
 
 	var compressedHeader bytes.Buffer
-	w := lzma.NewWriterLevel(&compressedHeader, 8)
-	_, err = w.Write(binHeader)
+	lw, err := codec.NewWriter(common.CodecLZMA, &compressedHeader, nil)
 	if err != nil {
-		runtime.GC()
 		return err
 	}
-	err = w.Close()
+	_, err = lw.Write(binHeader)
 	if err != nil {
+		_ = lw.Close()
 		runtime.GC()
 		return err
 	}
-	binHeader = nil
-	runtime.GC()
-
-	f, err := os.OpenFile(output, os.O_APPEND|os.O_WRONLY, 0600)
+	err = lw.Close()
 	if err != nil {
+		runtime.GC()
 		return err
 	}
-
-	defer f.Close()
+	binHeader = nil
+	runtime.GC()
 	defer runtime.GC()
 
 	chb := compressedHeader.Bytes()
 	defer compressedHeader.Reset()
+	if out.key != nil {
+		// file names are hidden too
+		chb = out.key.Seal(common.HeaderStream, chb)
+	}
 
-	_, err = f.Write(chb)
+	dataSize := aw.n
+	_, err = aw.Write(chb)
 	if err != nil {
 		return err
 	}
-	l := uint32(len(chb))
-	a := make([]byte, 4)
-	binary.BigEndian.PutUint32(a, l)
-	_, err = f.Write(a)
+	trailer := common.NewTrailer(uint32(dataSize), chb)
+	if out.encryption != nil {
+		trailer.Encrypt(out.encryption)
+	}
+	trailer.ArchiveHash = aw.hash.Sum(nil)
+	_, err = w.Write(trailer.ToBinary())
+	if err == nil && options.SigningKey != nil {
+		_, err = w.Write(common.Sign(trailer, options.SigningKey).ToBinary())
+	}
 
 	if err == nil {
-		ui.Current().OnEnd(ui.EvtPackDone)
+		out.ui.OnEnd(ui.EvtPackDone)
 	}
 
 	return err
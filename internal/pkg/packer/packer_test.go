@@ -20,9 +20,19 @@
 package packer
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/ui"
 )
 
 /*
@@ -72,3 +82,289 @@ func TestPackZerosizeFile(T *testing.T) {
 	}
 
 }
+
+/*
+TestPackTo tests, that the archive, written into the writer, is the same as
+the archive file, and its checksum is correct.
+*/
+func TestPackTo(T *testing.T) {
+	filename := "../../../test/output/packtest4.dat"
+	inputFolder := `../../../test/testdata/simplecontainer`
+	f, _ := filepath.Abs(filename)
+	_ = os.Remove(f)
+	defer os.Remove(f)
+
+	options := Options{ClassTransform: true, Dictionary: true}
+	err := PackWithOptions(inputFolder, filename, options)
+	if err != nil {
+		T.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile(f)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	err = PackTo(context.Background(), inputFolder, &b, options)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), expected) {
+		T.Errorf("Archive of %d bytes differs from the archive file of %d bytes", b.Len(), len(expected))
+	}
+	r := bytes.NewReader(b.Bytes())
+	trailer, err := common.ReadTrailer(r, r.Size())
+	if err != nil {
+		T.Fatal(err)
+	}
+	err = trailer.VerifyArchive(r)
+	if err != nil {
+		T.Error(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = PackTo(ctx, inputFolder, ioutil.Discard, options)
+	if !errors.Is(err, context.Canceled) {
+		T.Errorf("Canceled packing: %v", err)
+	}
+}
+
+// countUI counts the events of one operation
+type countUI struct {
+	ui.JrepackUI
+	done    int
+	written uint32
+}
+
+func (c *countUI) OnEnd(eventid int) {
+	if eventid == ui.EvtPackDone {
+		c.done++
+	}
+}
+
+func (c *countUI) Compress(info ui.Compressed) {
+	c.written = info.Total
+}
+
+/*
+TestPackCurrentUI tests, that Pack reports into the UI, set by ui.Set, since
+it has no options.
+*/
+func TestPackCurrentUI(T *testing.T) {
+	filename, _ := filepath.Abs("../../../test/output/packcurrentui.dat")
+	_ = os.Remove(filename)
+	defer os.Remove(filename)
+	progress := &countUI{JrepackUI: ui.Default()}
+	ui.Set(progress)
+	defer ui.Set(nil)
+
+	err := Pack(`../../../test/testdata/simplefolder`, filename, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if progress.done != 1 || progress.written == 0 {
+		T.Errorf("Unexpected %d pack done events, %d bytes written", progress.done, progress.written)
+	}
+}
+
+/*
+TestConcurrentPack tests, that the packings, running at the same time, write
+the same archives as the sequential ones. Run with -race to check, that they
+share no state. Every packing takes much memory, so only several of them run
+at once.
+*/
+func TestConcurrentPack(T *testing.T) {
+	inputs := []string{
+		`../../../test/testdata/simplefolder`,
+		`../../../test/testdata/nestedcontainer`,
+		`../../../test/testdata/classfiles`,
+	}
+	variants := []Options{
+		{},
+		{ClassTransform: true, BranchFilter: true, Dictionary: true},
+	}
+
+	type job struct {
+		input    string
+		options  Options
+		expected []byte
+	}
+	jobs := make([]job, 0)
+	for _, input := range inputs {
+		for _, options := range variants {
+			var b bytes.Buffer
+			err := PackTo(context.Background(), input, &b, options)
+			if err != nil {
+				T.Fatal(err)
+			}
+			jobs = append(jobs, job{input, options, b.Bytes()})
+		}
+	}
+
+	const workers = 3
+	queue := make(chan int)
+	errs := make([]error, len(jobs))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				errs[i] = checkPack(jobs[i].input, jobs[i].options, jobs[i].expected)
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			T.Error(err)
+		}
+	}
+}
+
+// meetUI waits on the first compressed file for the other packing to compress
+// its first file
+type meetUI struct {
+	ui.JrepackUI
+	once  sync.Once
+	here  chan struct{}
+	other chan struct{}
+	met   bool
+}
+
+func (m *meetUI) Compress(info ui.Compressed) {
+	m.once.Do(func() {
+		close(m.here)
+		select {
+		case <-m.other:
+			m.met = true
+		case <-time.After(10 * time.Second):
+		}
+	})
+}
+
+/*
+TestPackOverlap tests, that the LZMA segments of two packings are written at
+the same time. Every packing keeps its LZMA segment open, while it waits for
+the other one, so the packings never meet, when LZMA encoders are serialized.
+*/
+func TestPackOverlap(T *testing.T) {
+	a := make(chan struct{})
+	b := make(chan struct{})
+	progress := []*meetUI{
+		{JrepackUI: ui.Default(), here: a, other: b},
+		{JrepackUI: ui.Default(), here: b, other: a},
+	}
+	errs := make([]error, len(progress))
+	var wg sync.WaitGroup
+	for i := range progress {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var out bytes.Buffer
+			errs[i] = PackTo(context.Background(), `../../../test/testdata/simplefolder`, &out, Options{UI: progress[i]})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, m := range progress {
+		if errs[i] != nil {
+			T.Fatal(errs[i])
+		}
+		if !m.met {
+			T.Errorf("Packing %d does not overlap with the other one", i)
+		}
+	}
+}
+
+// checkPack will pack the input and compare the archive with the expected one
+func checkPack(input string, options Options, expected []byte) error {
+	progress := &countUI{JrepackUI: ui.Default()}
+	options.UI = progress
+
+	var b bytes.Buffer
+	err := PackTo(context.Background(), input, &b, options)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(b.Bytes(), expected) {
+		return fmt.Errorf("%s: archive of %d bytes differs from the sequential archive of %d bytes", input, b.Len(), len(expected))
+	}
+	if progress.done != 1 {
+		return fmt.Errorf("%s: %d pack done events", input, progress.done)
+	}
+	if progress.written == 0 {
+		return fmt.Errorf("%s: no compress events", input)
+	}
+	r := bytes.NewReader(b.Bytes())
+	trailer, err := common.ReadTrailer(r, r.Size())
+	if err != nil {
+		return err
+	}
+	return trailer.VerifyArchive(r)
+}
+
+// cancelUI cancels the packing, when the first file is hashed
+type cancelUI struct {
+	ui.JrepackUI
+	cancel context.CancelFunc
+}
+
+func (c *cancelUI) Hashed(info ui.Hash) {
+	c.cancel()
+}
+
+/*
+TestPackContext tests, that the canceled packing returns the context error and
+removes the partial output file and header dumps.
+*/
+func TestPackContext(T *testing.T) {
+	filename := "../../../test/output/packtest5.dat"
+	f, _ := filepath.Abs(filename)
+	_ = os.Remove(f)
+	defer os.Remove(f)
+
+	inputs := []string{
+		`../../../test/testdata/simplefolder`,
+		`../../../test/testdata/nestedcontainer`,
+	}
+	for _, input := range inputs {
+		ctx, cancel := context.WithCancel(context.Background())
+		options := Options{
+			DumpHeader: true,
+			Dictionary: true,
+			UI:         &cancelUI{JrepackUI: ui.Default(), cancel: cancel},
+		}
+		err := PackContext(ctx, input, filename, options)
+		cancel()
+		if !errors.Is(err, context.Canceled) {
+			T.Errorf("%s: unexpected error %v", input, err)
+		}
+		for _, name := range []string{f, f + ".header", f + ".header.json"} {
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				T.Errorf("%s: partial output %s is left", input, name)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	err := PackContext(ctx, inputs[0], filename, Options{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		T.Errorf("Unexpected error %v", err)
+	}
+	if _, err := os.Stat(f); !os.IsNotExist(err) {
+		T.Error("Partial output is left")
+	}
+
+	err = PackContext(context.Background(), inputs[1], filename, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package packer
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+/*
+SignArchive will sign the archive by the private key. Signature is embedded
+at the end of the archive, previous embedded signature is replaced. Detached
+signature is written into the archive file name + ".sig" file.
+*/
+func SignArchive(filename string, key ed25519.PrivateKey, detached bool) error {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	_, size, err := common.ReadSignature(f, fi.Size())
+	if err != nil {
+		return err
+	}
+	trailer, err := common.ReadTrailer(f, size)
+	if err != nil {
+		return err
+	}
+	if trailer.Version == common.FormatVersionLegacy {
+		// legacy archive has no checksums to sign
+		return errors.New("Unable to sign archive of the legacy format, repack it")
+	}
+	signature := common.Sign(trailer, key).ToBinary()
+
+	if detached {
+		return ioutil.WriteFile(filename+".sig", signature, 0666)
+	}
+
+	err = f.Truncate(size)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteAt(signature, size)
+	return err
+}
@@ -0,0 +1,386 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexript/jrepack/internal/pkg/bcj"
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+// maxDecoders is the number of the segment decoders, kept by the archive for
+// the next reading
+const maxDecoders = 4
+
+/*
+Archive is the opened archive file with the read header. Data is decoded on
+request, so the archive may be read by several goroutines.
+
+Segment decoders are kept after the reading of the data, the next data of the
+same segment is decoded from the position of the kept decoder. So the data is
+read fastest in the order of the data offsets. Reading of the data before the
+already read one decodes the segment from its start.
+*/
+type Archive struct {
+	Trailer *common.Trailer
+	Header  *common.Header
+
+	f      *os.File
+	key    *common.Key
+	limits common.Limits
+
+	mu sync.Mutex
+
+	// decoders are the kept segment decoders, the least recently used is first
+	decoders []*segmentDecoder
+}
+
+// segmentDecoder is the forward decoder of the data segment, pos is the
+// offset of the next decoded byte
+type segmentDecoder struct {
+	segment int
+	r       io.ReadCloser
+	pos     uint32
+}
+
+// OpenArchive will open the archive file and read its header. Signature is
+// checked, when the options have the trusted keys.
+func OpenArchive(filename string, options Options) (*Archive, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open archive file: %v", err)
+	}
+	fi, err := f.Stat()
+	if err == nil && fi.IsDir() {
+		err = fmt.Errorf("%s is a folder", filename)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	defaultSignatureFile(filename, &options)
+	_, err = checkSignature(f, fi.Size(), &options)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	trailer, header, key, err := readHeader(f, fi.Size(), &options.Limits, options.Password)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Archive{
+		Trailer: trailer,
+		Header:  header,
+		f:       f,
+		key:     key,
+		limits:  options.Limits,
+	}, nil
+}
+
+// Close will close the archive file and the kept decoders
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	decoders := a.decoders
+	a.decoders = nil
+	a.mu.Unlock()
+	for _, d := range decoders {
+		_ = d.r.Close()
+	}
+	return a.f.Close()
+}
+
+// Entries will return all entries of the archive in the header order
+func (a *Archive) Entries() []Entry {
+	return entries(a.Header)
+}
+
+// OpenEntry will open data of the file entry, like OpenData does
+func (a *Archive) OpenEntry(e Entry) (io.ReadCloser, error) {
+	if e.Folder || e.Container {
+		return nil, fmt.Errorf("%s is not a file", e.Path)
+	}
+	if e.data == common.NoData {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	return a.OpenData(e.data)
+}
+
+// ReadFiles will decode data of the file entries, data of the other entries
+// is nil. Every segment is decoded once.
+func (a *Archive) ReadFiles(list []Entry) ([][]byte, error) {
+	wanted := make(map[uint32]bool)
+	for _, e := range list {
+		if !e.Folder && !e.Container && e.data != common.NoData {
+			wanted[e.data] = true
+		}
+	}
+	data := make(map[uint32][]byte, len(wanted))
+	err := a.ReadBlobs(wanted, func(dataRecord *common.DataRecord, b []byte) error {
+		data[dataRecord.Offset] = append([]byte(nil), b...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	files := make([][]byte, len(list))
+	for i, e := range list {
+		if !e.Folder && !e.Container {
+			files[i] = data[e.data]
+		}
+	}
+	return files, nil
+}
+
+// ReadData will decode the data record with the given offset and check its
+// hash summ. Only the segment of the data record is decoded.
+func (a *Archive) ReadData(offset uint32) ([]byte, error) {
+	r, err := a.OpenData(offset)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+/*
+OpenData will open the reader of the data record with the given offset. Data
+is decoded while it is read, hash summ is checked, when the reader reaches the
+end of data. Data with the branch filter is decoded before OpenData returns.
+*/
+func (a *Archive) OpenData(offset uint32) (io.ReadCloser, error) {
+	i := sort.Search(len(a.Header.Data), func(i int) bool { return a.Header.Data[i].Offset >= offset })
+	if i == len(a.Header.Data) || a.Header.Data[i].Offset != offset {
+		return nil, fmt.Errorf("%w: no data record at offset %d", common.ErrCorrupted, offset)
+	}
+	dataRecord := a.Header.Data[i]
+	err := a.limits.CheckData(int64(dataRecord.Size), int64(dataRecord.Size))
+	if err != nil {
+		return nil, err
+	}
+	dr := &dataReader{
+		a:      a,
+		record: dataRecord,
+		hash:   common.NewHash(int64(dataRecord.Size)),
+		left:   int64(dataRecord.Size),
+	}
+	if dataRecord.Size == 0 {
+		dr.r = bytes.NewReader(nil)
+		return dr, nil
+	}
+
+	segment := sort.Search(len(a.Header.Segments), func(i int) bool {
+		s := a.Header.Segments[i]
+		return uint64(s.Offset)+uint64(s.Size) > uint64(offset)
+	})
+	if segment == len(a.Header.Segments) {
+		return nil, fmt.Errorf("%w: data at offset %d is not inside of the segment", common.ErrCorrupted, offset)
+	}
+	d, err := a.decoder(segment, offset)
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.CopyN(ioutil.Discard, d.r, int64(offset-d.pos))
+	d.pos += uint32(n)
+	if err != nil {
+		_ = d.r.Close()
+		return nil, err
+	}
+	if dataRecord.Filter == bcj.None {
+		dr.d = d
+		dr.r = d.r
+		return dr, nil
+	}
+
+	if !bcj.Supported(dataRecord.Filter) {
+		a.keep(d)
+		return nil, fmt.Errorf("Unsupported data filter %d", dataRecord.Filter)
+	}
+	// filter is applied to the whole data, so the filtered bytes are read
+	// from the decoder and the hash summ is checked on the restored bytes
+	b := make([]byte, dataRecord.Size)
+	read, err := io.ReadFull(d.r, b)
+	d.pos += uint32(read)
+	if err != nil {
+		_ = d.r.Close()
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			err = fmt.Errorf("%w: data at offset %d is truncated", common.ErrCorrupted, offset)
+		}
+		return nil, err
+	}
+	a.keep(d)
+	bcj.Decode(dataRecord.Filter, b)
+	dr.r = bytes.NewReader(b)
+	return dr, nil
+}
+
+// decoder will take the kept decoder of the segment, which is not past the
+// offset, or open the new decoder at the segment start
+func (a *Archive) decoder(segment int, offset uint32) (*segmentDecoder, error) {
+	a.mu.Lock()
+	for i := len(a.decoders) - 1; i >= 0; i-- {
+		d := a.decoders[i]
+		if d.segment == segment && d.pos <= offset {
+			a.decoders = append(a.decoders[:i], a.decoders[i+1:]...)
+			a.mu.Unlock()
+			return d, nil
+		}
+	}
+	a.mu.Unlock()
+
+	position := int64(0)
+	for _, s := range a.Header.Segments[:segment] {
+		position += int64(s.Packed)
+	}
+	s := a.Header.Segments[segment]
+	var sr io.Reader = io.NewSectionReader(a.f, position, int64(s.Packed))
+	if a.key != nil {
+		sr = a.key.Reader(sr, uint32(segment))
+	}
+	r, err := openSegment(sr, s, a.Header.Dictionary, &a.limits)
+	if err != nil {
+		return nil, err
+	}
+	return &segmentDecoder{segment: segment, r: r, pos: s.Offset}, nil
+}
+
+// keep will keep the decoder for the next reading, the least recently used
+// decoder is closed, when there are too many decoders
+func (a *Archive) keep(d *segmentDecoder) {
+	a.mu.Lock()
+	a.decoders = append(a.decoders, d)
+	var dropped *segmentDecoder
+	if len(a.decoders) > maxDecoders {
+		dropped = a.decoders[0]
+		a.decoders = a.decoders[1:]
+	}
+	a.mu.Unlock()
+	if dropped != nil {
+		_ = dropped.r.Close()
+	}
+}
+
+// dataReader reads the data record from the segment decoder and checks its
+// hash summ at the end of data
+type dataReader struct {
+	a      *Archive
+	d      *segmentDecoder
+	r      io.Reader
+	record *common.DataRecord
+	hash   hash.Hash
+	left   int64
+	err    error
+}
+
+func (r *dataReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.left == 0 {
+		r.finish()
+		return 0, r.err
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.r.Read(p)
+	r.hash.Write(p[:n])
+	r.left -= int64(n)
+	if r.d != nil {
+		r.d.pos += uint32(n)
+	}
+	switch {
+	case r.left == 0:
+		r.finish()
+		if r.err != io.EOF {
+			return n, r.err
+		}
+	case err == io.EOF:
+		r.fail(fmt.Errorf("%w: data at offset %d is truncated", common.ErrCorrupted, r.record.Offset))
+		return n, r.err
+	case err != nil:
+		r.fail(err)
+		return n, err
+	}
+	return n, nil
+}
+
+// finish will check the hash summ of the read data and keep the decoder
+func (r *dataReader) finish() {
+	if !bytes.Equal(r.hash.Sum(nil), r.record.Hash) {
+		r.fail(&HashError{Paths: dataPaths(r.a.Header, r.record)})
+		return
+	}
+	r.err = io.EOF
+	r.Close()
+}
+
+// fail will close the decoder, its position is unknown after the error
+func (r *dataReader) fail(err error) {
+	r.err = err
+	if r.d != nil {
+		_ = r.d.r.Close()
+		r.d = nil
+	}
+}
+
+// Close will keep the decoder for the next reading
+func (r *dataReader) Close() error {
+	if r.d != nil {
+		r.a.keep(r.d)
+		r.d = nil
+	}
+	if r.err == nil {
+		r.err = fmt.Errorf("Data reader is closed")
+	}
+	return nil
+}
+
+// ReadBlobs will decode the wanted data records, check their hash summs and
+// call fn for every record. Only segments with the wanted data are decoded.
+// Data is valid only until fn returns.
+func (a *Archive) ReadBlobs(wanted map[uint32]bool, fn func(dataRecord *common.DataRecord, b []byte) error) error {
+	_, err := readBlobs(context.Background(), a.Header, a.key, a.f, &a.limits, wanted, func(dataRecord *common.DataRecord, b []byte) error {
+		if !bytes.Equal(common.Hash(b), dataRecord.Hash) {
+			return &HashError{Paths: dataPaths(a.Header, dataRecord)}
+		}
+		return fn(dataRecord, b)
+	})
+	return err
+}
+
+// ModTime is the modification time of the archive file
+func (a *Archive) ModTime() time.Time {
+	fi, err := a.f.Stat()
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
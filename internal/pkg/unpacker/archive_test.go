@@ -0,0 +1,136 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/internal/pkg/packer"
+)
+
+func TestArchiveDecoders(T *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 8; i++ {
+		files[fmt.Sprintf("lib/file%d.txt", i)] = fmt.Sprintf("body of the file %d", i)
+	}
+	filename := packTree(T, "archivedecoders", files)
+	defer dropTree("archivedecoders")
+
+	a, err := OpenArchive(filename, Options{Limits: common.DefaultLimits})
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer a.Close()
+	if len(a.Header.Segments) != 1 || len(a.Header.Data) != len(files) {
+		T.Fatalf("Unexpected %d segments, %d data records", len(a.Header.Segments), len(a.Header.Data))
+	}
+
+	var first *segmentDecoder
+	for i, dataRecord := range a.Header.Data {
+		_, err := a.ReadData(dataRecord.Offset)
+		if err != nil {
+			T.Fatal(err)
+		}
+		if len(a.decoders) != 1 {
+			T.Fatalf("Unexpected %d kept decoders", len(a.decoders))
+		}
+		if i == 0 {
+			first = a.decoders[0]
+		} else if a.decoders[0] != first {
+			T.Errorf("Decoder is not reused for record %d", i)
+		}
+	}
+
+	// reading backwards restarts the segment
+	rc, err := a.OpenData(a.Header.Data[0].Offset)
+	if err != nil {
+		T.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(iotest.OneByteReader(rc))
+	rc.Close()
+	if err != nil || uint32(len(b)) != a.Header.Data[0].Size {
+		T.Errorf("Unexpected data %q, %v", b, err)
+	}
+	if len(a.decoders) != 2 || a.decoders[1] == first {
+		T.Errorf("Segment is not decoded from the start")
+	}
+
+	last := a.Header.Data[len(a.Header.Data)-1]
+	last.Hash = append([]byte(nil), last.Hash...)
+	last.Hash[0] ^= 0xff
+	_, err = a.ReadData(last.Offset)
+	var hashError *HashError
+	if !errors.As(err, &hashError) {
+		T.Errorf("Hash mismatch is not detected: %v", err)
+	}
+	if _, err := a.ReadData(last.Offset + 1); !errors.Is(err, common.ErrCorrupted) {
+		T.Errorf("Missing data record is read: %v", err)
+	}
+}
+
+func TestArchiveFilteredDecoders(T *testing.T) {
+	files := map[string]string{
+		"lib/a.txt":     "text before the native library",
+		"lib/libjvm.so": string(nativeSample()),
+		"lib/zz.txt":    "text after the native library",
+	}
+	filename := packTreeWithOptions(T, "archivefiltered", files, packer.Options{BranchFilter: true})
+	defer dropTree("archivefiltered")
+
+	a, err := OpenArchive(filename, Options{Limits: common.DefaultLimits})
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer a.Close()
+	filtered := -1
+	for i, dataRecord := range a.Header.Data {
+		if dataRecord.Filter != 0 {
+			filtered = i
+		}
+	}
+	if filtered < 0 || filtered == len(a.Header.Data)-1 {
+		T.Fatalf("Unexpected filtered record %d of %d", filtered, len(a.Header.Data))
+	}
+
+	b, err := a.ReadData(a.Header.Data[filtered].Offset)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if !bytes.Equal(b, nativeSample()) {
+		T.Errorf("Filtered data is not restored")
+	}
+	if len(a.decoders) != 1 {
+		T.Fatalf("Unexpected %d kept decoders", len(a.decoders))
+	}
+	d := a.decoders[0]
+	_, err = a.ReadData(a.Header.Data[filtered+1].Offset)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if len(a.decoders) != 1 || a.decoders[0] != d {
+		T.Errorf("Decoder is not reused after the filtered record")
+	}
+}
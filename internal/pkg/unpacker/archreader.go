@@ -29,54 +29,86 @@ import (
 	"runtime"
 
 	common "github.com/alexript/jrepack/internal/pkg/common"
-	"github.com/itchio/lzma"
+	"github.com/alexript/jrepack/internal/pkg/lzma"
 )
 
 func readArch(filename string) (*common.Header, error) {
+	return readArchLimited(filename, &common.Limits{}, "")
+}
+
+// readArchLimited will read header of the archive, checked against the limits.
+// Header of the encrypted archive is decrypted with the password.
+func readArchLimited(filename string, limits *common.Limits, password string) (*common.Header, error) {
+	_, header, _, err := readArchive(filename, limits, password)
+	return header, err
+}
+
+// readArchive will read trailer and header of the archive file and derive the
+// key of the encrypted archive
+func readArchive(filename string, limits *common.Limits, password string) (*common.Trailer, *common.Header, *common.Key, error) {
 	runtime.GC()
 
 	absPath, err := filepath.Abs(filename)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	fi, err := os.Stat(absPath)
 
 	if os.IsNotExist(err) {
-		return nil, errors.New("Path " + absPath + " does not exists")
+		return nil, nil, nil, errors.New("Path " + absPath + " does not exists")
 
 	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	if fi.IsDir() {
-		return nil, errors.New(absPath + " is a folder")
+		return nil, nil, nil, errors.New(absPath + " is a folder")
 	}
 
 	filesize := fi.Size()
 
 	f, err := os.Open(absPath)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to open archive file: %v", err)
+		return nil, nil, nil, fmt.Errorf("Unable to open archive file: %v", err)
 	}
 	defer f.Close()
 
-	point, err := f.Seek(-4, 2) // 4 bytes from end
+	return readHeader(f, filesize, limits, password)
+}
+
+// readHeader will read trailer and header of the archive of the given size.
+// Key of the encrypted archive is derived once and returned for the data
+// segments, it is nil for the archive, which is not encrypted.
+func readHeader(f io.ReaderAt, filesize int64, limits *common.Limits, password string) (*common.Trailer, *common.Header, *common.Key, error) {
+	trailer, err := common.ReadTrailer(f, filesize)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to seek for header size. FileSize: %v, Current point: %v, Error: %v", filesize, point, err)
+		return nil, nil, nil, err
 	}
-	b2 := make([]byte, 4)
-	_, err = f.Read(b2)
+	err = limits.CheckSize("packed header", int64(trailer.HeaderSize))
 	if err != nil {
-		return nil, fmt.Errorf("Unable to read header size. FileSize: %v, Current point: %v, Error: %v", filesize, point, err)
+		return nil, nil, nil, err
 	}
-	packedHeaderSize := common.Order.Uint32(b2)
 
-	point, err = f.Seek(-(int64(packedHeaderSize) + 4), 2)
+	b2 := make([]byte, trailer.HeaderSize)
+	_, err = f.ReadAt(b2, trailer.HeaderOffset())
 	if err != nil {
-		return nil, fmt.Errorf("Unable to seek for header head. FileSize: %v, Current point: %v, Error: %v", filesize, point, err)
+		return nil, nil, nil, fmt.Errorf("Unable to read header: %v", err)
 	}
-	b2 = make([]byte, packedHeaderSize)
-	_, err = f.Read(b2)
+	err = trailer.VerifyHeader(b2)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to read header: %v", err)
+		return nil, nil, nil, err
+	}
+	key, err := trailer.Key(password)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if key != nil {
+		// header is not damaged, so it is the wrong key
+		b2, err = key.Open(common.HeaderStream, b2)
+		if err != nil {
+			return nil, nil, nil, common.ErrPassword
+		}
 	}
 
 	runtime.GC()
@@ -84,13 +116,36 @@ func readArch(filename string) (*common.Header, error) {
 	br := bytes.NewReader(b2)
 	var b bytes.Buffer
 	r := lzma.NewReader(br)
-	io.Copy(&b, r)
+	var lr io.Reader = r
+	if limits.MaxHeaderSize > 0 {
+		lr = io.LimitReader(r, limits.MaxHeaderSize+1)
+	}
+	_, err = io.Copy(&b, lr)
 	r.Close()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: unable to unpack header: %v", common.ErrCorrupted, err)
+	}
+	err = limits.CheckSize("header", int64(b.Len()))
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	uncompressedHeader := b.Bytes()
 
-	header := common.FromBinary(uncompressedHeader)
+	var header *common.Header
+	if trailer.Version == common.FormatVersionLegacy {
+		header, err = common.FromLegacyBinary(uncompressedHeader, trailer.DataSize, limits)
+	} else {
+		header, err = common.FromBinaryLimited(uncompressedHeader, limits)
+	}
 	uncompressedHeader = nil
 	b.Reset()
 	runtime.GC()
-	return header, nil
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	err = header.CheckLimits(limits)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return trailer, header, key, nil
 }
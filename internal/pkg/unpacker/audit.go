@@ -0,0 +1,201 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+// AuditReport is the difference of the installed folder from the archive
+type AuditReport struct {
+	Archive    string   `json:"archive"`
+	Folder     string   `json:"folder"`
+	Checked    int      `json:"checked"`
+	Modified   []string `json:"modified"`
+	Missing    []string `json:"missing"`
+	Unexpected []string `json:"unexpected"`
+}
+
+// OK is true, when installed files match the archive
+func (r *AuditReport) OK() bool {
+	return len(r.Modified)+len(r.Missing)+len(r.Unexpected) == 0
+}
+
+func (r *AuditReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Archive: %s\nFolder: %s\n", r.Archive, r.Folder)
+	for _, p := range r.Modified {
+		fmt.Fprintf(&b, "M %s\n", p)
+	}
+	for _, p := range r.Missing {
+		fmt.Fprintf(&b, "D %s\n", p)
+	}
+	for _, p := range r.Unexpected {
+		fmt.Fprintf(&b, "? %s\n", p)
+	}
+	fmt.Fprintf(&b, "Checked: %d files, modified: %d, missing: %d, unexpected: %d\n",
+		r.Checked, len(r.Modified), len(r.Missing), len(r.Unexpected))
+	if r.OK() {
+		b.WriteString("Result: PASS\n")
+	} else {
+		b.WriteString("Result: FAIL\n")
+	}
+	return b.String()
+}
+
+/*
+Audit will compare files of the installed folder with the archive.
+
+Folder is walked as it is walked by the packer, entries of the containers are
+compared too. Only the archive header is read, nothing is written.
+*/
+func Audit(inputFile, folder string, options Options) (*AuditReport, error) {
+	header, err := readArchLimited(inputFile, &options.Limits, options.Password)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(folder)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, errors.New(folder + " is not folder")
+	}
+
+	expected := make(map[string]Entry)
+	for _, e := range files(header) {
+		expected[e.Path] = e
+	}
+
+	report := &AuditReport{
+		Archive:    inputFile,
+		Folder:     folder,
+		Modified:   make([]string, 0),
+		Missing:    make([]string, 0),
+		Unexpected: make([]string, 0),
+	}
+	err = walkInstalled(folder, "", func(p string, size int64, hash []byte) {
+		e, ok := expected[p]
+		if !ok {
+			report.Unexpected = append(report.Unexpected, p)
+			return
+		}
+		delete(expected, p)
+		report.Checked++
+		// empty files have no hash summ in the archive
+		if int64(e.Size) != size || (size > 0 && !bytes.Equal(e.Hash, hash)) {
+			report.Modified = append(report.Modified, p)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for p := range expected {
+		report.Missing = append(report.Missing, p)
+	}
+	sort.Strings(report.Modified)
+	sort.Strings(report.Missing)
+	sort.Strings(report.Unexpected)
+	return report, nil
+}
+
+// walkInstalled will call fn for every file of the folder and for every entry
+// of the containers. Hash is calculated as the packer does.
+func walkInstalled(dirname string, prefix string, fn func(p string, size int64, hash []byte)) error {
+	infos, err := ioutil.ReadDir(dirname)
+	if err != nil {
+		return err
+	}
+	for _, fi := range infos {
+		name := path.Join(prefix, fi.Name())
+		fullname := filepath.Join(dirname, fi.Name())
+		if fi.IsDir() {
+			err = walkInstalled(fullname, name, fn)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, isContainer := common.IsContainer(fullname); isContainer {
+			err = walkContainer(fullname, name, fn)
+			if err == nil {
+				continue
+			}
+			// broken container is reported by the hash of the file
+		}
+
+		f, err := os.Open(fullname)
+		if err != nil {
+			return err
+		}
+		hash, err := common.HashReader(f, fi.Size())
+		f.Close()
+		if err != nil {
+			return err
+		}
+		fn(name, fi.Size(), hash)
+	}
+	return nil
+}
+
+// walkContainer will call fn for every file entry of the container
+func walkContainer(filename string, prefix string, fn func(p string, size int64, hash []byte)) error {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// entries are reported, when the whole container is read
+	hashes := make([][]byte, len(r.File))
+	for i, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		hashes[i], err = common.HashReader(rc, int64(f.UncompressedSize64))
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	for i, f := range r.File {
+		if hashes[i] != nil {
+			fn(path.Join(prefix, f.Name), int64(f.UncompressedSize64), hashes[i])
+		}
+	}
+	return nil
+}
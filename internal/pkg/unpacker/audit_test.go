@@ -0,0 +1,90 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+)
+
+func TestAudit(T *testing.T) {
+	files := map[string]string{
+		"bin/java":              "java",
+		"lib/empty":             "",
+		"lib/security/cacerts":  "certificates",
+		"lib/ext/a.jar/A.class": "class A",
+		"lib/ext/a.jar/B.class": "class B",
+		"lib/libjava.so":        "native",
+	}
+	filename := packTree(T, "audit", files)
+	installed := filepath.Join(treeRoot("audit"), "jre")
+	defer dropTree("audit")
+
+	report, err := Audit(filename, installed, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+	if !report.OK() || report.Checked != len(files) {
+		T.Errorf("Unexpected report of the same folder:\n%s", report)
+	}
+
+	// drift: patched file, patched jar entry, missing library, extra jar
+	files["lib/security/cacerts"] = "patched"
+	files["lib/ext/a.jar/B.class"] = "class B patched"
+	delete(files, "lib/libjava.so")
+	files["lib/ext/extra.jar/X.class"] = "extra"
+	common.RemoveDirReq(installed)
+	writeTree(T, installed, files)
+
+	before, err := ioutil.ReadDir(filepath.Join(installed, "lib"))
+	if err != nil {
+		T.Fatal(err)
+	}
+	report, err = Audit(filename, installed, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+	after, err := ioutil.ReadDir(filepath.Join(installed, "lib"))
+	if err != nil || len(after) != len(before) {
+		T.Errorf("Installed folder is changed by the audit: %v", err)
+	}
+
+	check := func(what string, paths []string, expected ...string) {
+		if len(paths) != len(expected) {
+			T.Errorf("Unexpected %s files %v", what, paths)
+			return
+		}
+		for i := range paths {
+			if paths[i] != expected[i] {
+				T.Errorf("Unexpected %s files %v, expected %v", what, paths, expected)
+				return
+			}
+		}
+	}
+	check("modified", report.Modified, "lib/ext/a.jar/B.class", "lib/security/cacerts")
+	check("missing", report.Missing, "lib/libjava.so")
+	check("unexpected", report.Unexpected, "lib/ext/extra.jar/X.class")
+	if report.OK() {
+		T.Error("Drift is not reported")
+	}
+}
@@ -22,36 +22,59 @@ package unpacker
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
+	"github.com/alexript/jrepack/internal/pkg/bcj"
+	"github.com/alexript/jrepack/internal/pkg/classfile"
+	"github.com/alexript/jrepack/internal/pkg/codec"
 	common "github.com/alexript/jrepack/internal/pkg/common"
-	"github.com/alexript/jrepack/ui"
-	"github.com/itchio/lzma"
 )
 
 const (
 	uint32max = (1 << 32) - 1
 )
 
+var (
+	// ErrUnsafePath is the error for the archive entries, which escape the output folder
+	ErrUnsafePath = errors.New("Unsafe path in archive")
+)
+
 // GetOutputPath will transform outputdir string into disk path + path inside of archive
 func GetOutputPath(h *common.Header, outputdir string, parentid uint32) (p *string, archp *string, err error) {
+	return getOutputPath(h, outputdir, parentid, false)
+}
+
+// getOutputPath is GetOutputPath, which can unwrap containers into the folders
+func getOutputPath(h *common.Header, outputdir string, parentid uint32, unwrap bool) (p *string, archp *string, err error) {
 
 	if parentid < 1 {
 		return &outputdir, nil, nil
 	}
+	if parentid > uint32(len(h.Folders)) {
+		return nil, nil, fmt.Errorf("Unable to find folder record %d", parentid)
+	}
 
 	parent := h.Folders[parentid-1]
 
 	if string(parent.Name) == "_root_" {
 		return &outputdir, nil, nil
 	}
+	err = checkName(string(parent.Name))
+	if err != nil {
+		return nil, nil, err
+	}
 
-	pdir, adir, err := GetOutputPath(h, outputdir, parent.Parent)
+	pdir, adir, err := getOutputPath(h, outputdir, parent.Parent, unwrap)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -62,7 +85,7 @@ func GetOutputPath(h *common.Header, outputdir string, parentid uint32) (p *stri
 	var dirname string
 	var archdir string
 	var archdirp *string
-	if parent.Flags == common.FArchive {
+	if parent.Flags == common.FArchive && !unwrap {
 		dirname = path.Join(*pdir, string(parent.Name))
 		archdir = ""
 		archdirp = &archdir
@@ -77,50 +100,79 @@ func GetOutputPath(h *common.Header, outputdir string, parentid uint32) (p *stri
 		}
 	}
 
+	err = checkInside(outputdir, dirname)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	return &dirname, archdirp, nil
 }
 
-var (
-	// OpenedZipFiles is the map of already opened archive files.
-	OpenedZipFiles map[string]*os.File
+// checkName will check, that the name of the folder record is the single path element.
+// Drive letters are rejected on Windows, where they change the root of the path.
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") ||
+		filepath.VolumeName(name) != "" {
+		return fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	return nil
+}
 
-	// ZipWriters is the map of already opened zip writers
-	ZipWriters map[string]*zip.Writer
-)
+// checkInside will check, that the path is inside of the root folder
+func checkInside(root string, p string) error {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(p))
+	if err != nil || filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%w: %s is outside of %s", ErrUnsafePath, p, root)
+	}
+	return nil
+}
 
-func initOpenedZipFiles() {
-	OpenedZipFiles = make(map[string]*os.File)
-	ZipWriters = make(map[string]*zip.Writer)
+// fileWriter writes the unpacked files into the sink, entries of the
+// containers are collected into the rebuilt zip files
+type fileWriter struct {
+	sink Sink
+
+	// files is the map of already opened archive files.
+	files map[string]io.WriteCloser
+
+	// zips is the map of already opened zip writers
+	zips map[string]*zip.Writer
 }
 
-func closeOpenedZipFiles() {
-	for _, writer := range ZipWriters {
-		_ = writer.Close()
+func newFileWriter(sink Sink) *fileWriter {
+	return &fileWriter{
+		sink:  sink,
+		files: make(map[string]io.WriteCloser),
+		zips:  make(map[string]*zip.Writer),
 	}
-	for _, file := range OpenedZipFiles {
-		_ = file.Close()
+}
+
+// close will finish all rebuilt containers, first error is returned
+func (w *fileWriter) close() error {
+	var err error
+	for _, writer := range w.zips {
+		if e := writer.Close(); err == nil {
+			err = e
+		}
 	}
+	for _, file := range w.files {
+		if e := file.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
 }
 
-func saveToArch(archpath string, filename string, b []byte, isfolder bool) error {
-	var targetFile *os.File
-	var zipWriter *zip.Writer
-	_, err := os.Stat(archpath)
-	if err != nil && os.IsNotExist(err) {
-		targetFile, err = os.Create(archpath)
-		zipWriter = zip.NewWriter(targetFile)
-		OpenedZipFiles[archpath] = targetFile
-		ZipWriters[archpath] = zipWriter
-	} else {
-		if err == nil {
-			targetFile = OpenedZipFiles[archpath]
-			zipWriter = ZipWriters[archpath]
-		} else {
+func (w *fileWriter) saveToArch(archpath string, filename string, b []byte, isfolder bool) error {
+	zipWriter, ok := w.zips[archpath]
+	if !ok {
+		targetFile, err := w.sink.Create(archpath)
+		if err != nil {
 			return err
 		}
-	}
-	if err != nil {
-		return err
+		zipWriter = zip.NewWriter(targetFile)
+		w.files[archpath] = targetFile
+		w.zips[archpath] = zipWriter
 	}
 
 	fl := uint64(0)
@@ -156,8 +208,12 @@ func saveToArch(archpath string, filename string, b []byte, isfolder bool) error
 	return err
 }
 
-func writeFile(outputdir string, header *common.Header, file *common.FolderRecord, b []byte) error {
-	diskpath, archpath, err := GetOutputPath(header, outputdir, file.Parent)
+func (w *fileWriter) writeFile(header *common.Header, file *common.FolderRecord, b []byte, unwrap bool) error {
+	err := checkName(string(file.Name))
+	if err != nil {
+		return err
+	}
+	diskpath, archpath, err := getOutputPath(header, ".", file.Parent, unwrap)
 	if err != nil {
 		return err
 	}
@@ -168,105 +224,325 @@ func writeFile(outputdir string, header *common.Header, file *common.FolderRecor
 
 	if archpath == nil {
 		// simple file
-		err := os.MkdirAll(*diskpath, 0777)
-		if err != nil {
-			return err
-		}
 		filename := path.Join(*diskpath, string(file.Name))
 		if file.Flags == common.FFolder {
-			err := os.MkdirAll(filename, 0777)
-			if err != nil {
-				return err
-			}
-		} else {
-			f, err := os.Create(filename)
-			if err != nil {
-				return err
-			}
-			defer f.Close()
-			if b != nil {
-				_, err = f.Write(b)
-				if err != nil {
-					return err
-				}
-			}
+			return w.sink.Mkdir(filename)
 		}
-	} else {
-		// file to archive
-		archdir := path.Dir(*diskpath)
-		err := os.MkdirAll(archdir, 0777)
+		err := w.sink.Mkdir(*diskpath)
 		if err != nil {
 			return err
 		}
-		filename := path.Join(*archpath, string(file.Name))
-		err = saveToArch(*diskpath, filename, b, file.Flags == common.FFolder)
+		f, err := w.sink.Create(filename)
 		if err != nil {
 			return err
 		}
+		if b != nil {
+			_, err = f.Write(b)
+		}
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		return err
 	}
-	return nil
+
+	// file to archive
+	err = w.sink.Mkdir(path.Dir(*diskpath))
+	if err != nil {
+		return err
+	}
+	filename := path.Join(*archpath, string(file.Name))
+	return w.saveToArch(*diskpath, filename, b, file.Flags == common.FFolder)
+}
+
+// openSegment will create reader of the uncompressed segment data
+func openSegment(r io.Reader, segment *common.SegmentRecord, dict []byte, limits *common.Limits) (io.ReadCloser, error) {
+	cr, err := codec.NewReader(segment.Codec, r, dict)
+	if err != nil {
+		return nil, err
+	}
+
+	switch segment.Transform {
+	case common.TransformNone:
+		return cr, nil
+
+	case common.TransformClass:
+		defer cr.Close()
+		err = limits.CheckData(0, int64(segment.Size))
+		if err != nil {
+			return nil, err
+		}
+		// encoded classes are not much bigger, than the decoded ones
+		b, err := ioutil.ReadAll(io.LimitReader(cr, 2*int64(segment.Size)+1024))
+		if err != nil {
+			return nil, err
+		}
+		classes, err := classfile.Decode(b)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decode classes segment: %v", err)
+		}
+		return ioutil.NopCloser(bytes.NewReader(bytes.Join(classes, nil))), nil
+	}
+
+	_ = cr.Close()
+	return nil, fmt.Errorf("Unsupported segment transform %d", segment.Transform)
 }
 
 // Decompress is the entry point for decompressing process.
 func Decompress(header *common.Header, filename string, output string) error {
+	return DecompressWithOptions(header, filename, output, Options{})
+}
+
+// DecompressWithOptions is the decompressing with the given options.
+// Hash summ of every file is checked, mismatched files are reported by HashError.
+func DecompressWithOptions(header *common.Header, filename string, output string, options Options) error {
+	return DecompressContext(context.Background(), header, filename, output, options)
+}
 
+// DecompressContext is DecompressWithOptions, which is stopped, when the
+// context is done. Context is checked between the files and the read blocks
+// of the data segments. Output folder is not created by the decompressing, so
+// the already written files are left, UnPackContext removes them.
+func DecompressContext(ctx context.Context, header *common.Header, filename string, output string, options Options) error {
 	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
 	defer f.Close()
+
+	fi, err := f.Stat()
 	if err != nil {
 		return err
 	}
+	trailer, err := common.ReadTrailer(f, fi.Size())
+	if err != nil {
+		return err
+	}
+	key, err := trailer.Key(options.Password)
+	if err != nil {
+		return err
+	}
+	return decompress(ctx, header, key, f, fi.Size(), DirSink(output), options)
+}
+
+// decompress will write files of the header into the sink, data segments are
+// read from the archive of the given size and decrypted with the key
+func decompress(ctx context.Context, header *common.Header, key *common.Key, f io.ReaderAt, size int64, sink Sink, options Options) error {
+	var err error
+	if options.Select != nil {
+		err = options.Select.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	selected := options.Select.folders(header)
+	var wanted map[uint32]bool
+	if selected != nil {
+		// data of the not selected files is not decoded, when the format allows
+		wanted = make(map[uint32]bool)
+		for i, folder := range header.Folders {
+			if selected[i] && folder.Flags == common.FData && folder.Data != common.NoData {
+				wanted[folder.Data] = true
+			}
+		}
+		// output folder exists, even when nothing is selected
+		err = sink.Mkdir(".")
+		if err != nil {
+			return err
+		}
+	}
+
+	w := newFileWriter(sink)
+	err = writeFiles(ctx, header, f, key, w, options, selected, wanted)
+	if e := w.close(); err == nil {
+		err = e
+	}
+	return err
+}
 
-	initOpenedZipFiles()
-	defer closeOpenedZipFiles()
+// writeFiles will write folders and empty files, then decode data segments
+// and write the files with data. Context is checked before every file.
+func writeFiles(ctx context.Context, header *common.Header, f io.ReaderAt, key *common.Key, w *fileWriter, options Options, selected []bool, wanted map[uint32]bool) error {
+	var err error
 
+	progress := options.progress()
 	foldersNum := len(header.Folders)
 	readedFolders := 0
 
-	for _, folder := range header.Folders {
-		if (folder.Flags == common.FData || folder.Flags == common.FFolder) && folder.Data == uint32(0xFFFFFFFF) {
+	for i, folder := range header.Folders {
+		if (folder.Flags == common.FData || folder.Flags == common.FFolder) && folder.Data == common.NoData {
+			err = ctx.Err()
+			if err != nil {
+				return err
+			}
 			readedFolders++
-			ui.Current().Unpack(readedFolders, foldersNum)
-			err = writeFile(output, header, &folder, nil)
+			progress.Unpack(readedFolders, foldersNum)
+			if selected != nil && !selected[i] {
+				continue
+			}
+			err = w.writeFile(header, &folder, nil, options.Unwrap)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	needToRead := int64(header.Size)
-	readed := int64(0)
-
-	var b bytes.Buffer
-
-	r := lzma.NewReader(f)
-
-	for _, dataRecord := range header.Data {
-		b.Reset()
-		n, err := io.CopyN(&b, r, int64(dataRecord.Size))
+	mismatched := make([]string, 0)
+	readed, err := readBlobs(ctx, header, key, f, &options.Limits, wanted, func(dataRecord *common.DataRecord, b []byte) error {
+		err := ctx.Err()
 		if err != nil {
 			return err
 		}
-		readed += n
+		valid := bytes.Equal(common.Hash(b), dataRecord.Hash)
+		if !valid && !options.Lenient {
+			return &HashError{Paths: dataPaths(header, dataRecord)}
+		}
 
-		for _, folder := range header.Folders {
+		for i, folder := range header.Folders {
 			if folder.Flags == common.FData && folder.Data == uint32(dataRecord.Offset) {
+				if selected != nil && !selected[i] {
+					continue
+				}
+				if !valid {
+					mismatched = append(mismatched, header.FullPath(uint32(i+1)))
+				}
 				readedFolders++
-				err = writeFile(output, header, &folder, b.Bytes())
-				ui.Current().Unpack(readedFolders, foldersNum)
+				err := w.writeFile(header, &folder, b, options.Unwrap)
+				progress.Unpack(readedFolders, foldersNum)
 				if err != nil {
 					return err
 				}
 			}
 		}
-
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	_ = r.Close()
-	b.Reset()
 
 	runtime.GC()
-	if readed != needToRead {
-		return fmt.Errorf("Readed: %d, Expected: %d", readed, needToRead)
+	if selected == nil && readed != int64(header.Size) {
+		return fmt.Errorf("Readed: %d, Expected: %d", readed, header.Size)
+	}
+	if len(mismatched) > 0 {
+		return &HashError{Paths: mismatched}
 	}
 
 	return nil
 }
+
+// contextReader fails the reading, when the context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	err := c.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// readBlobs will decode data segments and call fn for every wanted data record,
+// nil wanted set means all data records. Segments without wanted data are
+// skipped, not wanted data records of the decoded segments are discarded.
+// Segments are decrypted by the key, if it is not nil.
+// Data is valid only until fn returns. Number of the decoded bytes is returned.
+// Context is checked before every read of the packed data.
+func readBlobs(ctx context.Context, header *common.Header, key *common.Key, f io.ReaderAt, limits *common.Limits, wanted map[uint32]bool, fn func(dataRecord *common.DataRecord, b []byte) error) (int64, error) {
+	readed := int64(0)
+
+	var b bytes.Buffer
+	defer b.Reset()
+
+	position := int64(0)
+	next := 0
+	for i, segment := range header.Segments {
+		end := segment.Offset + segment.Size
+		if wanted != nil && !segmentWanted(header, next, end, wanted) {
+			for next < len(header.Data) && header.Data[next].Offset < end {
+				next++
+			}
+			position += int64(segment.Packed)
+			continue
+		}
+
+		var sr io.Reader = &contextReader{ctx: ctx, r: io.NewSectionReader(f, position, int64(segment.Packed))}
+		if key != nil {
+			sr = key.Reader(sr, uint32(i))
+		}
+		r, err := openSegment(sr, segment, header.Dictionary, limits)
+		if err != nil {
+			return readed, err
+		}
+		position += int64(segment.Packed)
+
+		for next < len(header.Data) && header.Data[next].Offset < end {
+			dataRecord := header.Data[next]
+			next++
+
+			err = limits.CheckData(int64(dataRecord.Size), readed+int64(dataRecord.Size))
+			if err != nil {
+				_ = r.Close()
+				return readed, err
+			}
+
+			if wanted != nil && !wanted[dataRecord.Offset] {
+				n, err := io.CopyN(ioutil.Discard, r, int64(dataRecord.Size))
+				readed += n
+				if err != nil {
+					_ = r.Close()
+					return readed, err
+				}
+				continue
+			}
+
+			b.Reset()
+			n, err := io.CopyN(&b, r, int64(dataRecord.Size))
+			readed += n
+			if err != nil {
+				_ = r.Close()
+				return readed, err
+			}
+
+			if dataRecord.Filter != bcj.None {
+				if !bcj.Supported(dataRecord.Filter) {
+					_ = r.Close()
+					return readed, fmt.Errorf("Unsupported data filter %d", dataRecord.Filter)
+				}
+				bcj.Decode(dataRecord.Filter, b.Bytes())
+			}
+
+			err = fn(dataRecord, b.Bytes())
+			if err != nil {
+				_ = r.Close()
+				return readed, err
+			}
+		}
+		_ = r.Close()
+	}
+
+	return readed, nil
+}
+
+// segmentWanted will check, that any data record from next up to the segment end is wanted
+func segmentWanted(header *common.Header, next int, end uint32, wanted map[uint32]bool) bool {
+	for ; next < len(header.Data) && header.Data[next].Offset < end; next++ {
+		if wanted[header.Data[next].Offset] {
+			return true
+		}
+	}
+	return false
+}
+
+// dataPaths will return paths of all files, which refer to the data record
+func dataPaths(header *common.Header, dataRecord *common.DataRecord) []string {
+	paths := make([]string, 0)
+	for i, folder := range header.Folders {
+		if folder.Flags == common.FData && folder.Data == dataRecord.Offset {
+			paths = append(paths, header.FullPath(uint32(i+1)))
+		}
+	}
+	return paths
+}
@@ -0,0 +1,219 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+// Change is the file, which differs between two archives
+type Change struct {
+	Path    string `json:"path"`
+	OldPath string `json:"oldPath,omitempty"`
+	OldSize uint32 `json:"oldSize"`
+	NewSize uint32 `json:"newSize"`
+	OldHash string `json:"oldHash,omitempty"`
+	NewHash string `json:"newHash,omitempty"`
+}
+
+// DiffTotals is the number of the changed files and bytes
+type DiffTotals struct {
+	Added        int   `json:"added"`
+	AddedBytes   int64 `json:"addedBytes"`
+	Removed      int   `json:"removed"`
+	RemovedBytes int64 `json:"removedBytes"`
+	Changed      int   `json:"changed"`
+	OldBytes     int64 `json:"changedOldBytes"`
+	NewBytes     int64 `json:"changedNewBytes"`
+	Renamed      int   `json:"renamed"`
+	RenamedBytes int64 `json:"renamedBytes"`
+	Unchanged    int   `json:"unchanged"`
+}
+
+/*
+Diff is the difference of the files of two archives, entries of the containers
+are compared too. Files are compared by the hash summ, file of the old archive
+with the same hash summ and the other path is reported as renamed.
+*/
+type Diff struct {
+	Old     string     `json:"old"`
+	New     string     `json:"new"`
+	Added   []Change   `json:"added"`
+	Removed []Change   `json:"removed"`
+	Changed []Change   `json:"changed"`
+	Renamed []Change   `json:"renamed"`
+	Totals  DiffTotals `json:"totals"`
+}
+
+// Empty is true, when archives have the same files
+func (d *Diff) Empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Changed)+len(d.Renamed) == 0
+}
+
+// DiffArchives will compare files of two archives. Only headers are read,
+// data segments are not decoded.
+func DiffArchives(oldFile, newFile string, options Options) (*Diff, error) {
+	oldHeader, err := readArchLimited(oldFile, &options.Limits, options.Password)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", oldFile, err)
+	}
+	newHeader, err := readArchLimited(newFile, &options.Limits, options.Password)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", newFile, err)
+	}
+	d := diffHeaders(oldHeader, newHeader)
+	d.Old = oldFile
+	d.New = newFile
+	return d, nil
+}
+
+// files will return files of the header, sorted by path
+func files(header *common.Header) []Entry {
+	list := make([]Entry, 0)
+	for _, e := range entries(header) {
+		if !e.Folder && !e.Container {
+			list = append(list, e)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+	return list
+}
+
+func hashString(hash []byte) string {
+	if hash == nil {
+		return ""
+	}
+	return hex.EncodeToString(hash)
+}
+
+func diffHeaders(oldHeader, newHeader *common.Header) *Diff {
+	d := &Diff{
+		Added:   make([]Change, 0),
+		Removed: make([]Change, 0),
+		Changed: make([]Change, 0),
+		Renamed: make([]Change, 0),
+	}
+
+	newFiles := make(map[string]Entry)
+	for _, e := range files(newHeader) {
+		newFiles[e.Path] = e
+	}
+
+	// files of the old archive, which are absent in the new one, by hash summ
+	removed := make(map[string][]Entry)
+	removedOrder := make([]Entry, 0)
+	for _, o := range files(oldHeader) {
+		n, ok := newFiles[o.Path]
+		if !ok {
+			removed[hashString(o.Hash)] = append(removed[hashString(o.Hash)], o)
+			removedOrder = append(removedOrder, o)
+			continue
+		}
+		delete(newFiles, o.Path)
+		if bytes.Equal(o.Hash, n.Hash) {
+			d.Totals.Unchanged++
+			continue
+		}
+		d.Changed = append(d.Changed, Change{
+			Path:    o.Path,
+			OldSize: o.Size,
+			NewSize: n.Size,
+			OldHash: hashString(o.Hash),
+			NewHash: hashString(n.Hash),
+		})
+		d.Totals.OldBytes += int64(o.Size)
+		d.Totals.NewBytes += int64(n.Size)
+	}
+
+	added := make([]Entry, 0, len(newFiles))
+	for _, n := range newFiles {
+		added = append(added, n)
+	}
+	sort.Slice(added, func(i, j int) bool {
+		return added[i].Path < added[j].Path
+	})
+
+	renamed := make(map[string]bool)
+	for _, n := range added {
+		h := hashString(n.Hash)
+		// empty files have no hash summ, they are not renamed
+		if candidates := removed[h]; h != "" && len(candidates) > 0 {
+			o := candidates[0]
+			removed[h] = candidates[1:]
+			renamed[o.Path] = true
+			d.Renamed = append(d.Renamed, Change{
+				Path:    n.Path,
+				OldPath: o.Path,
+				OldSize: o.Size,
+				NewSize: n.Size,
+				OldHash: h,
+				NewHash: h,
+			})
+			d.Totals.RenamedBytes += int64(n.Size)
+			continue
+		}
+		d.Added = append(d.Added, Change{Path: n.Path, NewSize: n.Size, NewHash: h})
+		d.Totals.AddedBytes += int64(n.Size)
+	}
+	for _, o := range removedOrder {
+		if !renamed[o.Path] {
+			d.Removed = append(d.Removed, Change{Path: o.Path, OldSize: o.Size, OldHash: hashString(o.Hash)})
+			d.Totals.RemovedBytes += int64(o.Size)
+		}
+	}
+
+	d.Totals.Added = len(d.Added)
+	d.Totals.Removed = len(d.Removed)
+	d.Totals.Changed = len(d.Changed)
+	d.Totals.Renamed = len(d.Renamed)
+	return d
+}
+
+func (d *Diff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", d.Old, d.New)
+	for _, c := range d.Added {
+		fmt.Fprintf(&b, "A %12d %s\n", c.NewSize, c.Path)
+	}
+	for _, c := range d.Removed {
+		fmt.Fprintf(&b, "D %12d %s\n", c.OldSize, c.Path)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&b, "M %12d %s (was %d bytes)\n", c.NewSize, c.Path, c.OldSize)
+	}
+	for _, c := range d.Renamed {
+		fmt.Fprintf(&b, "R %12d %s -> %s\n", c.NewSize, c.OldPath, c.Path)
+	}
+	t := d.Totals
+	fmt.Fprintf(&b, "Added: %d files, %d bytes\n", t.Added, t.AddedBytes)
+	fmt.Fprintf(&b, "Removed: %d files, %d bytes\n", t.Removed, t.RemovedBytes)
+	fmt.Fprintf(&b, "Changed: %d files, %d bytes -> %d bytes\n", t.Changed, t.OldBytes, t.NewBytes)
+	fmt.Fprintf(&b, "Renamed: %d files, %d bytes\n", t.Renamed, t.RenamedBytes)
+	fmt.Fprintf(&b, "Unchanged: %d files\n", t.Unchanged)
+	return b.String()
+}
@@ -0,0 +1,197 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/internal/pkg/packer"
+)
+
+// writeTree will create folder with the files, names with ".jar/" are
+// written into the jar
+func writeTree(T *testing.T, dir string, files map[string]string) {
+	jars := make(map[string]map[string]string)
+	for name, body := range files {
+		if i := strings.Index(name, ".jar/"); i >= 0 {
+			jar := name[:i+4]
+			if jars[jar] == nil {
+				jars[jar] = make(map[string]string)
+			}
+			jars[jar][name[i+5:]] = body
+			continue
+		}
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0777)
+		if err == nil {
+			err = ioutil.WriteFile(p, []byte(body), 0666)
+		}
+		if err != nil {
+			T.Fatal(err)
+		}
+	}
+	for jar, entries := range jars {
+		p := filepath.Join(dir, filepath.FromSlash(jar))
+		err := os.MkdirAll(filepath.Dir(p), 0777)
+		if err != nil {
+			T.Fatal(err)
+		}
+		f, err := os.Create(p)
+		if err != nil {
+			T.Fatal(err)
+		}
+		w := zip.NewWriter(f)
+		for name, body := range entries {
+			zw, err := w.Create(name)
+			if err == nil {
+				_, err = zw.Write([]byte(body))
+			}
+			if err != nil {
+				T.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			T.Fatal(err)
+		}
+		f.Close()
+	}
+}
+
+// treeRoot is the folder of the test tree, files are written into its "jre"
+// subfolder and unpacked into its "out" subfolder
+func treeRoot(name string) string {
+	root, _ := filepath.Abs("../../../test/output/" + name)
+	return root
+}
+
+// packTree will pack the folder with the files into the archive
+func packTree(T *testing.T, name string, files map[string]string) string {
+	return packTreeWithOptions(T, name, files, packer.Options{})
+}
+
+// packTreeWithOptions will pack the folder with the files into the archive
+// with the given options
+func packTreeWithOptions(T *testing.T, name string, files map[string]string, options packer.Options) string {
+	root := treeRoot(name)
+	dropTree(name)
+	writeTree(T, filepath.Join(root, "jre"), files)
+	filename := root + ".dat"
+	err := packer.PackWithOptions(filepath.Join(root, "jre"), filename, options)
+	if err != nil {
+		T.Fatal(err)
+	}
+	return filename
+}
+
+// dropTree will remove the test tree and its archive
+func dropTree(name string) {
+	root := treeRoot(name)
+	common.RemoveDirReq(root)
+	os.Remove(root + ".dat")
+}
+
+// checkTree will compare the unpacked folder with the files, which are not
+// written into the jars
+func checkTree(T *testing.T, dir string, files map[string]string) {
+	for name, body := range files {
+		result, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			T.Fatal(err)
+		}
+		if string(result) != body {
+			T.Errorf("File %s is not restored", name)
+		}
+	}
+}
+
+func TestDiffArchives(T *testing.T) {
+	oldFile := packTree(T, "diffold", map[string]string{
+		"bin/java":              "java 8u172",
+		"lib/security/certs":    "old certificates",
+		"lib/ext/a.jar/A.class": "class A v1",
+		"lib/ext/a.jar/C.class": "class C",
+		"lib/old.txt":           "removed file",
+		"lib/moved.so":          "native library",
+		"release":               "JAVA_VERSION=1.8",
+	})
+	newFile := packTree(T, "diffnew", map[string]string{
+		"bin/java":              "java 8u181!",
+		"lib/security/certs":    "old certificates",
+		"lib/ext/a.jar/A.class": "class A v2",
+		"lib/ext/a.jar/B.class": "class B",
+		"lib/ext/a.jar/C.class": "class C",
+		"lib/amd64/moved.so":    "native library",
+		"release":               "JAVA_VERSION=1.8",
+	})
+	defer dropTree("diffold")
+	defer dropTree("diffnew")
+
+	d, err := DiffArchives(oldFile, newFile, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+	check := func(what string, changes []Change, expected ...string) {
+		if len(changes) != len(expected) {
+			T.Errorf("Unexpected %s files %v", what, changes)
+			return
+		}
+		for i, c := range changes {
+			if c.Path != expected[i] {
+				T.Errorf("Unexpected %s file %v, expected %s", what, c, expected[i])
+			}
+		}
+	}
+	check("added", d.Added, "lib/ext/a.jar/B.class")
+	check("removed", d.Removed, "lib/old.txt")
+	check("changed", d.Changed, "bin/java", "lib/ext/a.jar/A.class")
+	check("renamed", d.Renamed, "lib/amd64/moved.so")
+	if len(d.Renamed) == 1 && d.Renamed[0].OldPath != "lib/moved.so" {
+		T.Errorf("Unexpected renamed file %v", d.Renamed[0])
+	}
+
+	t := d.Totals
+	if t.AddedBytes != 7 || t.RemovedBytes != 12 || t.OldBytes != 20 || t.NewBytes != 21 || t.RenamedBytes != 14 || t.Unchanged != 3 {
+		T.Errorf("Unexpected totals %+v", t)
+	}
+	if !strings.Contains(d.String(), "R           14 lib/moved.so -> lib/amd64/moved.so") {
+		T.Errorf("Unexpected text diff:\n%s", d)
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		T.Fatal(err)
+	}
+	var decoded Diff
+	if err := json.Unmarshal(b, &decoded); err != nil || decoded.Totals != d.Totals || len(decoded.Changed) != 2 {
+		T.Errorf("Unexpected json diff %s: %v", b, err)
+	}
+
+	d, err = DiffArchives(oldFile, oldFile, Options{})
+	if err != nil || !d.Empty() {
+		T.Errorf("Archive differs from itself: %v, %v", d, err)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/internal/pkg/packer"
+)
+
+func TestUnpackEncrypted(T *testing.T) {
+	root, _ := filepath.Abs(outputDirRootTest)
+	dirName := filepath.Join(root, "encrypted")
+	filename, _ := filepath.Abs("../../../test/output/encryptedtest.dat")
+	os.Remove(filename)
+	common.RemoveDirReq(dirName)
+	defer os.Remove(filename)
+	defer common.RemoveDirReq(dirName)
+
+	err := packer.PackWithOptions(inputFolderTest, filename, packer.Options{
+		Password:       "secret",
+		ClassTransform: true,
+		Dictionary:     true,
+		BranchFilter:   true,
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	// file names are not visible in the archive
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	filepath.Walk(inputFolderTest, func(p string, info os.FileInfo, err error) error {
+		if err == nil && len(info.Name()) >= 6 && bytes.Contains(b, []byte(info.Name())) {
+			T.Errorf("Name %s is visible in the encrypted archive", info.Name())
+		}
+		return nil
+	})
+
+	_, err = readArch(filename)
+	if !errors.Is(err, common.ErrEncrypted) {
+		T.Errorf("Encrypted archive is read without password: %v", err)
+	}
+	err = UnPackWithOptions(filename, dirName, Options{Password: "wrong"})
+	if !errors.Is(err, common.ErrPassword) {
+		T.Errorf("Wrong password accepted: %v", err)
+	}
+	if _, err := os.Stat(dirName); !os.IsNotExist(err) {
+		T.Error("Output folder is left after the wrong password")
+	}
+
+	header, err := readArchLimited(filename, &common.Limits{}, "secret")
+	if err != nil {
+		T.Fatal(err)
+	}
+	if len(header.Folders) == 0 {
+		T.Error("No folders in the decrypted header")
+	}
+	err = UnPackWithOptions(filename, dirName, Options{Password: "secret"})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	report, err := VerifyWithOptions(filename, Options{Password: "secret"})
+	if err != nil {
+		T.Fatal(err)
+	}
+	if !report.OK() || !report.Encrypted || report.Files == 0 {
+		T.Errorf("Unexpected report of the encrypted archive: %v", report)
+	}
+
+	// damaged data segment is detected by the authentication of the record
+	err = ioutil.WriteFile(filename, flipByte(b, 10), 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+	report, err = VerifyWithOptions(filename, Options{Password: "secret"})
+	if err != nil {
+		T.Fatal(err)
+	}
+	if report.OK() {
+		T.Error("Damaged encrypted archive verified")
+	}
+}
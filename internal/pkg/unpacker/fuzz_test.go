@@ -0,0 +1,81 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/internal/pkg/packer"
+)
+
+// seedArchives will pack test/testdata folders with all packing options
+func seedArchives(tb testing.TB) [][]byte {
+	root := "../../../test/testdata"
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	filename := "../../../test/output/fuzzseed.dat"
+
+	seeds := make([][]byte, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		for _, options := range []packer.Options{{}, {ClassTransform: true, BranchFilter: true, Dictionary: true, Auto: true}} {
+			os.Remove(filename)
+			err := packer.PackWithOptions(filepath.Join(root, entry.Name()), filename, options)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			b, err := ioutil.ReadFile(filename)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			seeds = append(seeds, b)
+		}
+	}
+	os.Remove(filename)
+	return seeds
+}
+
+func FuzzReadHeader(F *testing.F) {
+	for _, seed := range seedArchives(F) {
+		F.Add(seed)
+	}
+	F.Fuzz(func(T *testing.T, b []byte) {
+		limits := common.DefaultLimits
+		_, header, _, err := readHeader(bytes.NewReader(b), int64(len(b)), &limits, "")
+		if err != nil {
+			return
+		}
+
+		// data segments are not covered by the header checksum
+		_, _ = readBlobs(context.Background(), header, nil, bytes.NewReader(b), &limits, nil, func(*common.DataRecord, []byte) error {
+			return nil
+		})
+	})
+}
@@ -0,0 +1,167 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alexript/jrepack/internal/pkg/codec"
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+// Info is the summary of the archive, read from the trailer and header only
+type Info struct {
+	Archive    string
+	Version    uint16
+	Size       int64
+	DataSize   uint32
+	HeaderSize uint32
+	Encrypted  bool
+	Signed     bool
+
+	// Header fields are empty for the encrypted archive without password
+	Header       bool
+	Folders      int
+	Files        int
+	Containers   int
+	Blobs        int
+	UnpackedSize uint32
+	Segments     map[string]int
+
+	// Release is the properties of the JRE release file, nil when the JRE has no release file
+	Release common.Properties
+
+	// Metadata is the user defined properties, given at pack time
+	Metadata common.Properties
+}
+
+// ReadInfo will read the summary of the archive without decoding the data segments
+func ReadInfo(inputFile string, options Options) (*Info, error) {
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open archive file: %v", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	signature, _, err := common.ReadSignature(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	trailer, header, _, err := readHeader(f, fi.Size(), &options.Limits, options.Password)
+	if err != nil && !errors.Is(err, common.ErrEncrypted) {
+		return nil, err
+	}
+	if trailer == nil {
+		trailer, err = common.ReadTrailer(f, fi.Size())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	info := &Info{
+		Archive:    inputFile,
+		Version:    trailer.Version,
+		Size:       fi.Size(),
+		DataSize:   trailer.DataSize,
+		HeaderSize: trailer.HeaderSize,
+		Encrypted:  trailer.Encryption != nil,
+		Signed:     signature != nil,
+	}
+	if header == nil {
+		return info, nil
+	}
+
+	info.Header = true
+	info.Release = header.Release
+	info.Metadata = header.Metadata
+	info.Blobs = len(header.Data)
+	info.UnpackedSize = header.Size
+	for _, e := range entries(header) {
+		switch {
+		case e.Folder:
+			info.Folders++
+		case e.Container:
+			info.Containers++
+		default:
+			info.Files++
+		}
+	}
+	info.Segments = make(map[string]int)
+	for _, s := range header.Segments {
+		info.Segments[codec.Name(s.Codec)]++
+	}
+	return info, nil
+}
+
+func (i *Info) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Archive: %s\n", i.Archive)
+	fmt.Fprintf(&b, "Format version: %d\n", i.Version)
+	fmt.Fprintf(&b, "Archive size: %d bytes (data %d, header %d)\n", i.Size, i.DataSize, i.HeaderSize)
+	fmt.Fprintf(&b, "Encrypted: %s\n", yesNo(i.Encrypted))
+	fmt.Fprintf(&b, "Signed: %s\n", yesNo(i.Signed))
+	if !i.Header {
+		b.WriteString("Contents: encrypted, password is required\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Folders: %d, files: %d, containers: %d\n", i.Folders, i.Files, i.Containers)
+	fmt.Fprintf(&b, "Unique data: %d blobs, %d bytes\n", i.Blobs, i.UnpackedSize)
+
+	codecs := make([]string, 0, len(i.Segments))
+	for name, n := range i.Segments {
+		codecs = append(codecs, fmt.Sprintf("%s %d", name, n))
+	}
+	sort.Strings(codecs)
+	fmt.Fprintf(&b, "Segments: %s\n", strings.Join(codecs, ", "))
+
+	writeProperties(&b, "Release", i.Release)
+	writeProperties(&b, "Metadata", i.Metadata)
+	return b.String()
+}
+
+func writeProperties(b *strings.Builder, title string, p common.Properties) {
+	if len(p) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s:\n", title)
+	for _, prop := range p {
+		fmt.Fprintf(b, "  %s: %s\n", prop.Key, prop.Value)
+	}
+}
+
+// Modules will return names of the JRE modules from the release file
+func (i *Info) Modules() []string {
+	return strings.Fields(i.Release.Get("MODULES"))
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"path"
+	"sort"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+// Entry is the file, folder or container of the archive. Entry, which is
+// neither folder nor container, is the file.
+type Entry struct {
+	// Path is slash separated, entries of the containers are placed under the container path
+	Path      string
+	Folder    bool
+	Container bool
+	Size      uint32
+
+	// Hash is the hash summ of the file data, it is nil for folders and empty files
+	Hash []byte
+
+	// Shared is true, when the data is stored once for several entries
+	Shared bool
+
+	// ContainerPath is the path of the closest container of the entry, it is
+	// empty for the entries outside of the containers
+	ContainerPath string
+
+	// data is the offset of the file data, NoData for the empty files
+	data uint32
+}
+
+// Name is the last element of the entry path
+func (e Entry) Name() string {
+	return path.Base(e.Path)
+}
+
+// List will read the archive header and return all entries in the header order
+func List(inputFile string, options Options) ([]Entry, error) {
+	header, err := readArchLimited(inputFile, &options.Limits, options.Password)
+	if err != nil {
+		return nil, err
+	}
+	return entries(header), nil
+}
+
+// entries will return all entries of the header, except the root folder
+func entries(header *common.Header) []Entry {
+	data := make(map[uint32]*common.DataRecord, len(header.Data))
+	for _, d := range header.Data {
+		data[d.Offset] = d
+	}
+	refs := make(map[uint32]int, len(header.Data))
+	for _, folder := range header.Folders {
+		if folder.Flags == common.FData && folder.Data != common.NoData {
+			refs[folder.Data]++
+		}
+	}
+
+	// containers[id] is the closest container of the folder record
+	containers := make([]string, len(header.Folders)+1)
+	list := make([]Entry, 0, len(header.Folders))
+	for i, folder := range header.Folders {
+		id := i + 1
+		if int(folder.Parent) < id {
+			// packer writes parents before their children
+			containers[id] = containers[folder.Parent]
+		}
+		if folder.Parent == 0 && string(folder.Name) == "_root_" {
+			continue
+		}
+		e := Entry{
+			Path:          header.FullPath(uint32(id)),
+			Folder:        folder.Flags == common.FFolder,
+			Container:     folder.Flags == common.FArchive,
+			ContainerPath: containers[id],
+			data:          common.NoData,
+		}
+		if e.Container {
+			containers[id] = e.Path
+		}
+		if d, ok := data[folder.Data]; ok && folder.Flags == common.FData {
+			e.Size = d.Size
+			e.Hash = d.Hash
+			e.Shared = refs[folder.Data] > 1
+			e.data = folder.Data
+		}
+		list = append(list, e)
+	}
+	return list
+}
+
+// MatchEntries will return entries, which match the glob pattern.
+// Pattern with slash is matched against the full path, pattern without slash
+// is matched against the name of the entry.
+func MatchEntries(entries []Entry, pattern string) ([]Entry, error) {
+	// check pattern syntax once
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]Entry, 0)
+	for _, e := range entries {
+		if matchGlob(pattern, e.Path) {
+			matched = append(matched, e)
+		}
+	}
+	return matched, nil
+}
+
+// SortBySize will sort entries by size, largest first. Entries of the same
+// size are sorted by path.
+func SortBySize(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Size != entries[j].Size {
+			return entries[i].Size > entries[j].Size
+		}
+		return entries[i].Path < entries[j].Path
+	})
+}
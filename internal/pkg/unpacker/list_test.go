@@ -0,0 +1,187 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"crypto/ed25519"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/internal/pkg/packer"
+)
+
+func TestListInfo(T *testing.T) {
+	filename := "../../../test/output/listtest.dat"
+	os.Remove(filename)
+	defer os.Remove(filename)
+
+	err := packer.Pack(`../../../test/testdata/simplecontainer`, filename, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	entries, err := List(filename, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+	containers := 0
+	files := 0
+	for _, e := range entries {
+		if e.Path == "" || e.Path == "_root_" {
+			T.Errorf("Unexpected entry %v", e)
+		}
+		if e.Container {
+			containers++
+		} else if !e.Folder {
+			files++
+		}
+	}
+	if containers == 0 || files == 0 {
+		T.Errorf("Unexpected entries %v", entries)
+	}
+
+	info, err := ReadInfo(filename, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+	if !info.Header || info.Containers != containers || info.Files != files || info.Encrypted || info.Signed {
+		T.Errorf("Unexpected info %v", info)
+	}
+	fi, _ := os.Stat(filename)
+	if info.Size != fi.Size() || info.Segments["lzma"] == 0 {
+		T.Errorf("Unexpected info %v", info)
+	}
+}
+
+func TestInfoRelease(T *testing.T) {
+	filename := packTree(T, "inforelease", map[string]string{
+		"bin/java": "java",
+		"release":  "JAVA_VERSION=\"11.0.2\"\nIMPLEMENTOR=\"Oracle Corporation\"\nMODULES=\"java.base java.logging\"\n",
+	})
+	defer dropTree("inforelease")
+
+	info, err := ReadInfo(filename, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+	if info.Release.Get("JAVA_VERSION") != "11.0.2" || info.Release.Get("IMPLEMENTOR") != "Oracle Corporation" {
+		T.Errorf("Unexpected release %v", info.Release)
+	}
+	if modules := info.Modules(); len(modules) != 2 || modules[1] != "java.logging" {
+		T.Errorf("Unexpected modules %v", modules)
+	}
+	if !strings.Contains(info.String(), "JAVA_VERSION: 11.0.2") {
+		T.Errorf("Unexpected info:\n%s", info)
+	}
+}
+
+func TestInfoMetadata(T *testing.T) {
+	filename := "../../../test/output/metadatatest.dat"
+	os.Remove(filename)
+	defer os.Remove(filename)
+
+	public, private, err := common.GenerateKey()
+	if err != nil {
+		T.Fatal(err)
+	}
+	metadata := common.Properties{{Key: "build", Value: "1234"}, {Key: "commit", Value: "0a1b2c"}, {Key: "channel", Value: "beta"}}
+	err = packer.PackWithOptions(`../../../test/testdata/simplecontainer`, filename, packer.Options{
+		Metadata:   metadata,
+		SigningKey: private,
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	// metadata is in the signed header
+	_, err = VerifySignature(filename, Options{PublicKeys: []ed25519.PublicKey{public}, RequireSignature: true})
+	if err != nil {
+		T.Fatal(err)
+	}
+	info, err := ReadInfo(filename, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+	if len(info.Metadata) != len(metadata) || info.Metadata.Get("commit") != "0a1b2c" {
+		T.Errorf("Unexpected metadata %v", info.Metadata)
+	}
+	if !strings.Contains(info.String(), "channel: beta") {
+		T.Errorf("Unexpected info:\n%s", info)
+	}
+
+	err = packer.PackWithOptions(`../../../test/testdata/simplecontainer`, filename+"2", packer.Options{
+		Metadata: common.Properties{{Key: "build", Value: "1"}, {Key: "build", Value: "2"}},
+	})
+	os.Remove(filename + "2")
+	if err == nil {
+		T.Error("Duplicate metadata keys accepted")
+	}
+}
+
+func TestListShared(T *testing.T) {
+	filename := "../../../test/output/listsharedtest.dat"
+	os.Remove(filename)
+	defer os.Remove(filename)
+
+	err := packer.Pack(inputFolderTest, filename, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+	entries, err := List(filename, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	paths := make(map[string]Entry)
+	for _, e := range entries {
+		paths[e.Path] = e
+	}
+	shared := paths["f5/simplefolder.zip/f1/d1.txt"]
+	if !shared.Shared || shared.Size != 6 || shared.Hash == nil || shared.ContainerPath != "f5/simplefolder.zip" {
+		T.Errorf("Unexpected entry inside of container %v", shared)
+	}
+	if e := paths["other.txt"]; e.Shared || e.Hash == nil || e.ContainerPath != "" {
+		T.Errorf("Unexpected unique entry %v", e)
+	}
+	if e := paths["f1"]; !e.Folder || e.Hash != nil {
+		T.Errorf("Unexpected folder entry %v", e)
+	}
+
+	matched, err := MatchEntries(entries, "d1.txt")
+	if err != nil || len(matched) != 2 {
+		T.Errorf("Unexpected entries, matched by name: %v, %v", matched, err)
+	}
+	matched, err = MatchEntries(entries, "f5/*/f1/*")
+	if err != nil || len(matched) != 1 || matched[0].Path != "f5/simplefolder.zip/f1/d1.txt" {
+		T.Errorf("Unexpected entries, matched by path: %v, %v", matched, err)
+	}
+	if _, err := MatchEntries(entries, "["); err == nil {
+		T.Error("Invalid pattern accepted")
+	}
+
+	SortBySize(entries)
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Size > entries[i-1].Size {
+			T.Fatalf("Entries are not sorted by size: %v", entries)
+		}
+	}
+}
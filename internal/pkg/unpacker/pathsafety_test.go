@@ -0,0 +1,248 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/internal/pkg/lzma"
+)
+
+// writeArchive will write archive of the given header and uncompressed data.
+// Data is stored as the single segment, if header has no segments.
+func writeArchive(T *testing.T, filename string, h *common.Header, data []byte) {
+	if len(h.Segments) == 0 {
+		h.Size = uint32(len(data))
+		h.Segments = common.SegmentsHeader{{Size: h.Size, Packed: h.Size, Codec: common.CodecStore}}
+	}
+
+	var packed bytes.Buffer
+	w := lzma.NewWriterLevel(&packed, 8)
+	_, err := w.Write(common.ToBinary(h))
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	archive := append(append([]byte(nil), data...), packed.Bytes()...)
+	trailer := common.NewTrailer(uint32(len(data)), packed.Bytes())
+	err = trailer.Seal(bytes.NewReader(archive))
+	if err != nil {
+		T.Fatal(err)
+	}
+	archive = append(archive, trailer.ToBinary()...)
+
+	f, _ := filepath.Abs(filename)
+	err = ioutil.WriteFile(f, archive, 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+}
+
+// hostileHeader will create header with the file, placed into the given folders chain
+func hostileHeader(body []byte, folders []string, container int, name string) *common.Header {
+	h := common.NewHeader(0)
+	h.Pack(0, uint32(len(body)), common.Hash(body))
+	h.Folders = append(h.Folders, common.FolderRecord{Flags: common.FFolder, Data: common.NoData, Name: []byte("_root_")})
+	for i, folder := range folders {
+		flags := common.FFolder
+		if i == container {
+			flags = common.FArchive
+		}
+		h.Folders = append(h.Folders, common.FolderRecord{
+			Parent: uint32(len(h.Folders)),
+			Flags:  flags,
+			Data:   common.NoData,
+			Name:   []byte(folder),
+		})
+	}
+	h.Folders = append(h.Folders, common.FolderRecord{
+		Parent: uint32(len(h.Folders)),
+		Flags:  common.FData,
+		Data:   0,
+		Name:   []byte(name),
+	})
+	for i := range h.Folders {
+		h.Folders[i].Namelength = uint8(len(h.Folders[i].Name))
+	}
+	return h
+}
+
+func TestUnpackHostilePaths(T *testing.T) {
+	root, _ := filepath.Abs(outputDirRootTest)
+	dirName := filepath.Join(root, "hostile", "out")
+	filename := "../../../test/output/hostiletest.dat"
+	f, _ := filepath.Abs(filename)
+	defer os.Remove(f)
+	defer common.RemoveDirReq(filepath.Join(root, "hostile"))
+
+	body := []byte("evil")
+	cases := map[string]*common.Header{
+		"dotdot folder":      hostileHeader(body, []string{"..", ".."}, -1, "evil.txt"),
+		"dotdot file":        hostileHeader(body, []string{"lib"}, -1, ".."),
+		"slash in name":      hostileHeader(body, []string{"lib"}, -1, "../../evil.txt"),
+		"absolute name":      hostileHeader(body, nil, -1, "/tmp/evil.txt"),
+		"backslash in name":  hostileHeader(body, []string{"lib"}, -1, `..\..\evil.txt`),
+		"empty name":         hostileHeader(body, []string{""}, -1, "evil.txt"),
+		"container entry":    hostileHeader(body, []string{"lib", "rt.jar", ".."}, 1, "evil.txt"),
+		"container dotdot":   hostileHeader(body, []string{"..", "rt.jar"}, 1, "evil.txt"),
+		"dot folder":         hostileHeader(body, []string{"."}, -1, "evil.txt"),
+		"zero byte in name":  hostileHeader(body, []string{"lib"}, -1, "evil\x00.txt"),
+		"container absolute": hostileHeader(body, []string{"rt.jar"}, 0, "/evil.txt"),
+	}
+	if runtime.GOOS == "windows" {
+		cases["drive letter"] = hostileHeader(body, nil, -1, "C:evil.txt")
+	}
+	for name, h := range cases {
+		common.RemoveDirReq(filepath.Join(root, "hostile"))
+		writeArchive(T, filename, h, body)
+
+		err := UnPack(filename, dirName)
+		if !errors.Is(err, ErrUnsafePath) {
+			T.Errorf("%s: unexpected error %v", name, err)
+		}
+		for _, p := range []string{filepath.Join(root, "hostile", "evil.txt"), filepath.Join(root, "evil.txt"), "/tmp/evil.txt"} {
+			if _, err := os.Stat(p); err == nil {
+				os.Remove(p)
+				T.Errorf("%s: file %s is written outside of output folder", name, p)
+			}
+		}
+	}
+
+	// safe names are unpacked
+	common.RemoveDirReq(filepath.Join(root, "hostile"))
+	writeArchive(T, filename, hostileHeader(body, []string{"lib", "..lib"}, -1, "file..txt"), body)
+	err := UnPack(filename, dirName)
+	if err != nil {
+		T.Fatal(err)
+	}
+	result, err := ioutil.ReadFile(filepath.Join(dirName, "lib", "..lib", "file..txt"))
+	if err != nil || !bytes.Equal(result, body) {
+		T.Errorf("Safe file is not unpacked: %v", err)
+	}
+}
+
+func TestCheckName(T *testing.T) {
+	for _, name := range []string{"rt.jar", "..lib", "file..txt", "a:b"} {
+		if err := checkName(name); err != nil {
+			T.Errorf("Safe name %q rejected: %v", name, err)
+		}
+	}
+	// drive letter is the plain name, except Windows
+	err := checkName("C:evil.txt")
+	if (runtime.GOOS == "windows") != errors.Is(err, ErrUnsafePath) {
+		T.Errorf("Unexpected result for drive letter on %s: %v", runtime.GOOS, err)
+	}
+}
+
+func TestCheckInside(T *testing.T) {
+	cases := []struct {
+		path string
+		ok   bool
+	}{
+		{"out", true},
+		{"out/a/b", true},
+		{"out/a/../b", true},
+		{"out/..", false},
+		{"out/../other", false},
+		{"out/a/../../other", false},
+		{"/tmp", false},
+		{"outside", false},
+	}
+	for _, c := range cases {
+		err := checkInside("out", c.path)
+		if (err == nil) != c.ok {
+			T.Errorf("Unexpected result for %s: %v", c.path, err)
+		}
+	}
+}
+
+func TestUnpackLimits(T *testing.T) {
+	err := prepareTestData()
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer dropTestData()
+	root, _ := filepath.Abs(outputDirRootTest)
+	dirName := filepath.Join(root, outputDirNameTest)
+
+	cases := []Limits{
+		{MaxTotalSize: 1},
+		{MaxFileSize: 1},
+		{MaxEntries: 1},
+		{MaxDepth: 1},
+		{MaxHeaderSize: 1},
+	}
+	for _, limits := range cases {
+		err = UnPackWithOptions(filenameTest, dirName, Options{Limits: limits})
+		if !errors.Is(err, common.ErrLimit) {
+			T.Errorf("Limits %v: unexpected error %v", limits, err)
+		}
+		if _, err := os.Stat(dirName); !os.IsNotExist(err) {
+			T.Errorf("Limits %v: output folder is created", limits)
+		}
+		common.RemoveDirReq(dirName)
+	}
+
+	err = UnPackWithOptions(filenameTest, dirName, Options{Limits: common.DefaultLimits})
+	if err != nil {
+		T.Fatal(err)
+	}
+}
+
+func TestUnpackBomb(T *testing.T) {
+	root, _ := filepath.Abs(outputDirRootTest)
+	dirName := filepath.Join(root, "bomb", "out")
+	filename := "../../../test/output/bombtest.dat"
+	f, _ := filepath.Abs(filename)
+	defer os.Remove(f)
+	defer common.RemoveDirReq(filepath.Join(root, "bomb"))
+
+	// header declares 1 GiB file, which is not in data
+	body := []byte("bomb")
+	h := hostileHeader(body, nil, -1, "bomb.bin")
+	h.Data[0].Size = 1 << 30
+	h.Size = 1 << 30
+	h.Segments = common.SegmentsHeader{{Size: h.Size, Packed: uint32(len(body)), Codec: common.CodecStore}}
+	writeArchive(T, filename, h, body)
+
+	limits := common.DefaultLimits
+	err := UnPackWithOptions(filename, dirName, Options{Limits: limits})
+	if !errors.Is(err, common.ErrLimit) {
+		T.Errorf("Unexpected error %v", err)
+	}
+
+	report, err := VerifyWithLimits(filename, limits)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if report.OK() {
+		T.Error("Bomb is verified")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+/*
+Selector is the set of the patterns of the selective unpacking.
+
+Entry is selected, when its path or the path of any parent folder or container
+matches any pattern. Paths are slash separated, entries of the containers are
+placed under the container path.
+*/
+type Selector struct {
+	// Paths are the full paths of the selected entries
+	Paths []string
+
+	// Globs are the glob patterns, pattern without slash is matched against the name of the entry
+	Globs []string
+
+	// Regexps are matched against the full path of the entry
+	Regexps []*regexp.Regexp
+}
+
+// Validate will check syntax of the glob patterns
+func (s *Selector) Validate() error {
+	for _, g := range s.Globs {
+		_, err := path.Match(g, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match will check, that the path matches any pattern of the selector
+func (s *Selector) Match(p string) bool {
+	for _, sp := range s.Paths {
+		if strings.Trim(sp, "/") == p {
+			return true
+		}
+	}
+	for _, g := range s.Globs {
+		if matchGlob(g, p) {
+			return true
+		}
+	}
+	for _, r := range s.Regexps {
+		if r.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob will match pattern with slash against the full path and pattern
+// without slash against the name
+func matchGlob(pattern string, p string) bool {
+	if !strings.Contains(pattern, "/") {
+		p = path.Base(p)
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+// folders will mark selected folder records of the header.
+// Nil is returned for the nil selector, which selects everything.
+func (s *Selector) folders(header *common.Header) []bool {
+	if s == nil {
+		return nil
+	}
+	const (
+		unknown = iota
+		rejected
+		selected
+	)
+	state := make([]uint8, len(header.Folders))
+	var check func(id uint32) bool
+	check = func(id uint32) bool {
+		if id < 1 || id > uint32(len(header.Folders)) {
+			return false
+		}
+		if state[id-1] != unknown {
+			return state[id-1] == selected
+		}
+		// cycles are rejected, when header is read
+		state[id-1] = rejected
+		folder := header.Folders[id-1]
+		root := folder.Parent == 0 && string(folder.Name) == "_root_"
+		if (!root && s.Match(header.FullPath(id))) || check(folder.Parent) {
+			state[id-1] = selected
+		}
+		return state[id-1] == selected
+	}
+
+	result := make([]bool, len(header.Folders))
+	for i := range header.Folders {
+		result[i] = check(uint32(i + 1))
+	}
+	return result
+}
@@ -0,0 +1,183 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/internal/pkg/packer"
+)
+
+// unpackedFiles will return slash separated paths of the files inside of the folder
+func unpackedFiles(T *testing.T, dirName string) []string {
+	files := make([]string, 0)
+	err := filepath.Walk(dirName, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dirName, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestSelectorMatch(T *testing.T) {
+	s := &Selector{
+		Paths:   []string{"lib/security/cacerts", "/bin/"},
+		Globs:   []string{"*.so", "lib/*/*.jar"},
+		Regexps: []*regexp.Regexp{regexp.MustCompile(`^jmods/java\.base`)},
+	}
+	matched := []string{"lib/security/cacerts", "bin", "lib/amd64/libjava.so", "lib/ext/nashorn.jar", "jmods/java.base.jmod"}
+	for _, p := range matched {
+		if !s.Match(p) {
+			T.Errorf("%s is not matched", p)
+		}
+	}
+	for _, p := range []string{"lib/security", "bin/java", "lib/rt.jar", "lib/ext/a/b.jar", "jmods/java.sql.jmod"} {
+		if s.Match(p) {
+			T.Errorf("%s is matched", p)
+		}
+	}
+	if err := (&Selector{Globs: []string{"["}}).Validate(); err == nil {
+		T.Error("Invalid glob accepted")
+	}
+}
+
+func TestUnpackSelected(T *testing.T) {
+	root, _ := filepath.Abs(outputDirRootTest)
+	dirName := filepath.Join(root, "selected")
+	filename, _ := filepath.Abs("../../../test/output/selectedtest.dat")
+	os.Remove(filename)
+	common.RemoveDirReq(dirName)
+	defer os.Remove(filename)
+	defer common.RemoveDirReq(dirName)
+
+	err := packer.Pack(inputFolderTest, filename, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	cases := []struct {
+		selector Selector
+		unwrap   bool
+		files    []string
+	}{
+		{Selector{Paths: []string{"f3"}}, false, []string{"f3/f4/d4.txt"}},
+		{Selector{Globs: []string{"other.txt", "f1/*"}}, false, []string{"f1/d1.txt", "other.txt"}},
+		{Selector{Globs: []string{"d2.txt"}}, false, []string{"f2/d2.txt", "f5/simplefolder.zip"}},
+		{Selector{Regexps: []*regexp.Regexp{regexp.MustCompile(`zip/f[12]/`)}}, true, []string{"f5/simplefolder.zip/f1/d1.txt", "f5/simplefolder.zip/f2/d2.txt"}},
+		{Selector{Paths: []string{"missing"}}, false, []string{}},
+	}
+	for _, c := range cases {
+		common.RemoveDirReq(dirName)
+		selector := c.selector
+		err = UnPackWithOptions(filename, dirName, Options{Select: &selector, Unwrap: c.unwrap})
+		if err != nil {
+			T.Fatal(err)
+		}
+		files := unpackedFiles(T, dirName)
+		if len(files) != len(c.files) {
+			T.Errorf("Unexpected files %v, expected %v", files, c.files)
+			continue
+		}
+		for i := range files {
+			if files[i] != c.files[i] {
+				T.Errorf("Unexpected files %v, expected %v", files, c.files)
+				break
+			}
+		}
+	}
+
+	// rebuilt container has the selected entries only
+	common.RemoveDirReq(dirName)
+	err = UnPackWithOptions(filename, dirName, Options{Select: &Selector{Globs: []string{"d2.txt"}}})
+	if err != nil {
+		T.Fatal(err)
+	}
+	entries := readZipEntries(T, filepath.Join(dirName, "f5", "simplefolder.zip"))
+	if len(entries) != 1 || string(entries["f2/d2.txt"]) == "" {
+		T.Errorf("Unexpected entries of the rebuilt container: %v", entries)
+	}
+}
+
+func TestUnpackSelectedSkipsSegments(T *testing.T) {
+	root, _ := filepath.Abs(outputDirRootTest)
+	dirName := filepath.Join(root, "selectedsegments")
+	filename, _ := filepath.Abs("../../../test/output/selectedsegmentstest.dat")
+	os.Remove(filename)
+	common.RemoveDirReq(dirName)
+	defer os.Remove(filename)
+	defer common.RemoveDirReq(dirName)
+
+	err := packer.PackWithOptions(`../../../test/testdata/classfiles`, filename, packer.Options{ClassTransform: true})
+	if err != nil {
+		T.Fatal(err)
+	}
+	header, err := readArch(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	// damage the classes segment, manifest is in the other one
+	position := int64(0)
+	damaged := false
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	for _, s := range header.Segments {
+		if s.Transform == common.TransformClass {
+			for i := position; i < position+int64(s.Packed); i++ {
+				b[i] ^= 0x55
+			}
+			damaged = true
+		}
+		position += int64(s.Packed)
+	}
+	if !damaged || len(header.Segments) < 2 {
+		T.Fatalf("Unexpected segments %v", header.Segments)
+	}
+	err = ioutil.WriteFile(filename, b, 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	err = DecompressWithOptions(header, filename, dirName, Options{Select: &Selector{Globs: []string{"MANIFEST.MF"}}})
+	if err != nil {
+		T.Fatal(err)
+	}
+	entries := readZipEntries(T, filepath.Join(dirName, "example.jar"))
+	if len(entries) != 1 || len(entries["META-INF/MANIFEST.MF"]) == 0 {
+		T.Errorf("Unexpected entries of the rebuilt jar: %v", entries)
+	}
+}
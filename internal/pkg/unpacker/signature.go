@@ -0,0 +1,105 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+/*
+VerifySignature will check embedded or detached signature of the archive
+against the trusted public keys of the options. Detached signature is read
+from the options.SignatureFile or from the archive file name + ".sig" file.
+Key of the signer is returned.
+*/
+func VerifySignature(inputFile string, options Options) (ed25519.PublicKey, error) {
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open archive file: %v", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	defaultSignatureFile(inputFile, &options)
+	return verifySignature(f, fi.Size(), options)
+}
+
+// defaultSignatureFile will use the archive file name + ".sig" as the
+// detached signature, when the signature file is not given and it exists
+func defaultSignatureFile(inputFile string, options *Options) {
+	if options.SignatureFile != "" {
+		return
+	}
+	if _, err := os.Stat(inputFile + ".sig"); err == nil {
+		options.SignatureFile = inputFile + ".sig"
+	}
+}
+
+// verifySignature will check embedded signature of the archive of the given
+// size or the detached signature from options.SignatureFile
+func verifySignature(r io.ReaderAt, size int64, options Options) (ed25519.PublicKey, error) {
+	signature, size, err := common.ReadSignature(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if signature == nil {
+		if options.SignatureFile == "" {
+			return nil, common.ErrUnsigned
+		}
+		b, err := ioutil.ReadFile(options.SignatureFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read signature: %v", err)
+		}
+		signature, err = common.SignatureFromBinary(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	trailer, err := common.ReadTrailer(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return signature.PublicKey, signature.Verify(trailer, options.PublicKeys)
+}
+
+// checkSignature will verify the signature, when it is required or trusted
+// keys are given. Unsigned archive is accepted, when signature is not required.
+// Signed is true, when the signature is verified.
+func checkSignature(r io.ReaderAt, size int64, options *Options) (signed bool, err error) {
+	if !options.RequireSignature && len(options.PublicKeys) == 0 {
+		return false, nil
+	}
+	_, err = verifySignature(r, size, *options)
+	if errors.Is(err, common.ErrUnsigned) && !options.RequireSignature {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,159 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+	"github.com/alexript/jrepack/internal/pkg/packer"
+)
+
+func TestUnpackSigned(T *testing.T) {
+	root, _ := filepath.Abs(outputDirRootTest)
+	dirName := filepath.Join(root, "signed")
+	filename, _ := filepath.Abs("../../../test/output/signedtest.dat")
+	os.Remove(filename)
+	defer os.Remove(filename)
+	defer os.Remove(filename + ".sig")
+	defer common.RemoveDirReq(dirName)
+
+	public, private, err := common.GenerateKey()
+	if err != nil {
+		T.Fatal(err)
+	}
+	other, otherPrivate, err := common.GenerateKey()
+	if err != nil {
+		T.Fatal(err)
+	}
+	trusted := Options{PublicKeys: []ed25519.PublicKey{public}, RequireSignature: true}
+
+	err = packer.PackWithOptions(inputFolderTest, filename, packer.Options{SigningKey: private})
+	if err != nil {
+		T.Fatal(err)
+	}
+	signer, err := VerifySignature(filename, trusted)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if !signer.Equal(public) {
+		T.Error("Unexpected signer")
+	}
+	err = UnPackWithOptions(filename, dirName, trusted)
+	if err != nil {
+		T.Fatal(err)
+	}
+	common.RemoveDirReq(dirName)
+
+	// damaged data of the signed archive is refused in lenient mode too
+	signed, err := ioutil.ReadFile(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	err = ioutil.WriteFile(filename, flipByte(signed, 10), 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+	lenient := trusted
+	lenient.Lenient = true
+	err = UnPackWithOptions(filename, dirName, lenient)
+	if !errors.Is(err, common.ErrCorrupted) {
+		T.Errorf("Damaged signed archive accepted in lenient mode: %v", err)
+	}
+	if _, err := os.Stat(dirName); !os.IsNotExist(err) {
+		T.Error("Output folder is created")
+	}
+	err = ioutil.WriteFile(filename, signed, 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	// untrusted key
+	err = UnPackWithOptions(filename, dirName, Options{PublicKeys: []ed25519.PublicKey{other}})
+	if !errors.Is(err, common.ErrSignature) {
+		T.Errorf("Untrusted signature accepted: %v", err)
+	}
+
+	// signature of the other key replaces the embedded one
+	err = packer.SignArchive(filename, otherPrivate, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+	err = UnPackWithOptions(filename, dirName, trusted)
+	if !errors.Is(err, common.ErrSignature) {
+		T.Errorf("Untrusted signature accepted: %v", err)
+	}
+
+	// tampered trailer
+	err = packer.SignArchive(filename, private, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	size := len(b) - len(common.Sign(common.NewTrailer(0, nil), private).ToBinary())
+	err = ioutil.WriteFile(filename, flipByte(b, size-20), 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+	err = UnPackWithOptions(filename, dirName, trusted)
+	if !errors.Is(err, common.ErrSignature) {
+		T.Errorf("Tampered archive accepted: %v", err)
+	}
+	report, err := VerifyWithOptions(filename, trusted)
+	if err != nil || report.OK() {
+		T.Errorf("Tampered archive verified: %v", err)
+	}
+
+	// unsigned archive is accepted only without the signature requirement
+	err = ioutil.WriteFile(filename, b[:size], 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+	err = UnPackWithOptions(filename, dirName, trusted)
+	if !errors.Is(err, common.ErrUnsigned) {
+		T.Errorf("Unsigned archive accepted: %v", err)
+	}
+	err = UnPackWithOptions(filename, dirName, Options{PublicKeys: []ed25519.PublicKey{public}})
+	if err != nil {
+		T.Fatal(err)
+	}
+	common.RemoveDirReq(dirName)
+
+	// detached signature
+	err = packer.SignArchive(filename, private, true)
+	if err != nil {
+		T.Fatal(err)
+	}
+	report, err = VerifyWithOptions(filename, trusted)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if !report.OK() || report.Signer == "" {
+		T.Errorf("Detached signature is not verified: %v", report)
+	}
+}
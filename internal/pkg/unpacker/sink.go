@@ -0,0 +1,66 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Sink is the destination of the unpacked files. Names are slash separated
+// paths, relative to the output root ".", they are already checked to stay
+// inside of the root. Rebuilt containers are created as the files.
+type Sink interface {
+	// Mkdir will create the folder with all its parents
+	Mkdir(name string) error
+
+	// Create will create the file, its folder is already created
+	Create(name string) (io.WriteCloser, error)
+}
+
+// DirSink will write the unpacked files into the folder
+func DirSink(folder string) Sink {
+	return dirSink(folder)
+}
+
+type dirSink string
+
+// path will return the disk path of the name, checked once more
+func (d dirSink) path(name string) (string, error) {
+	p := filepath.Join(string(d), filepath.FromSlash(name))
+	return p, checkInside(string(d), p)
+}
+
+func (d dirSink) Mkdir(name string) error {
+	p, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, 0777)
+}
+
+func (d dirSink) Create(name string) (io.WriteCloser, error) {
+	p, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(p)
+}
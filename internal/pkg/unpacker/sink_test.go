@@ -0,0 +1,322 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/alexript/jrepack/internal/pkg/packer"
+	"github.com/alexript/jrepack/ui"
+)
+
+// memSink is the sink, which keeps unpacked files in memory
+type memSink struct {
+	folders map[string]bool
+	files   map[string]*bytes.Buffer
+}
+
+func newMemSink() *memSink {
+	return &memSink{folders: make(map[string]bool), files: make(map[string]*bytes.Buffer)}
+}
+
+func (m *memSink) Mkdir(name string) error {
+	m.folders[name] = true
+	return nil
+}
+
+func (m *memSink) Create(name string) (io.WriteCloser, error) {
+	b := new(bytes.Buffer)
+	m.files[name] = b
+	return nopWriteCloser{b}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestUnpackFrom(T *testing.T) {
+	var archive bytes.Buffer
+	err := packer.PackTo(context.Background(), `../../../test/testdata/simplecontainer`, &archive, packer.Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+	r := bytes.NewReader(archive.Bytes())
+
+	sink := newMemSink()
+	err = UnpackFrom(context.Background(), r, r.Size(), sink, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+	container, ok := sink.files["simplefolder.zip"]
+	if !ok || len(sink.files) != 1 {
+		T.Fatalf("Unexpected files %v", sink.files)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(container.Bytes()), int64(container.Len()))
+	if err != nil {
+		T.Fatal(err)
+	}
+	names := make(map[string]bool)
+	var expected []byte
+	for _, f := range zr.File {
+		names[f.Name] = true
+		if f.Name == "f3/f4/d4.txt" {
+			rc, err := f.Open()
+			if err != nil {
+				T.Fatal(err)
+			}
+			expected, _ = ioutil.ReadAll(rc)
+			rc.Close()
+		}
+	}
+	if !names["f3/f4/d4.txt"] || !names["f5/"] || len(names) != 9 {
+		T.Errorf("Unexpected container entries %v", names)
+	}
+
+	sink = newMemSink()
+	err = UnpackFrom(context.Background(), r, r.Size(), sink, Options{Unwrap: true})
+	if err != nil {
+		T.Fatal(err)
+	}
+	d4, ok := sink.files["simplefolder.zip/f3/f4/d4.txt"]
+	if !ok || !sink.folders["simplefolder.zip/f5"] {
+		T.Fatalf("Unexpected unwrapped files %v, folders %v", sink.files, sink.folders)
+	}
+	if len(expected) == 0 || d4.String() != string(expected) {
+		T.Errorf("Unexpected data %q, expected %q", d4, expected)
+	}
+
+	// damaged archive is refused before unpacking
+	damaged := append([]byte(nil), archive.Bytes()...)
+	damaged[0] ^= 0xFF
+	sink = newMemSink()
+	err = UnpackFrom(context.Background(), bytes.NewReader(damaged), int64(len(damaged)), sink, Options{})
+	if err == nil || len(sink.files) != 0 {
+		T.Errorf("Damaged archive accepted: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = UnpackFrom(ctx, r, r.Size(), newMemSink(), Options{})
+	if !errors.Is(err, context.Canceled) {
+		T.Errorf("Canceled unpacking: %v", err)
+	}
+}
+
+// sinkContents will return data of the unpacked files by name, entries of the
+// rebuilt containers are expanded, because their times differ
+func sinkContents(m *memSink) map[string]string {
+	contents := make(map[string]string)
+	for name, b := range m.files {
+		expandContainer(name, b.Bytes(), contents)
+	}
+	for name := range m.folders {
+		contents[name+"/"] = ""
+	}
+	return contents
+}
+
+func expandContainer(name string, b []byte, contents map[string]string) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		contents[name] = string(b)
+		return
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			contents[name+"!"+f.Name] = err.Error()
+			continue
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			contents[name+"!"+f.Name] = err.Error()
+			continue
+		}
+		expandContainer(name+"!"+f.Name, data, contents)
+	}
+}
+
+// progressUI keeps the last progress of one unpacking
+type progressUI struct {
+	ui.JrepackUI
+	done            int
+	readed, folders int
+}
+
+func (p *progressUI) OnEnd(eventid int) {
+	if eventid == ui.EvtUnpackDone {
+		p.done++
+	}
+}
+
+func (p *progressUI) Unpack(readedFolders, foldersNum int) {
+	p.readed, p.folders = readedFolders, foldersNum
+}
+
+/*
+TestUnPackCurrentUI tests, that UnPack reports into the UI, set by ui.Set,
+since it has no options.
+*/
+func TestUnPackCurrentUI(T *testing.T) {
+	filename := packTree(T, "currentui", map[string]string{"bin/java": "java launcher"})
+	defer dropTree("currentui")
+	progress := &progressUI{JrepackUI: ui.Default()}
+	ui.Set(progress)
+	defer ui.Set(nil)
+
+	err := UnPack(filename, filepath.Join(treeRoot("currentui"), "out"))
+	if err != nil {
+		T.Fatal(err)
+	}
+	if progress.done != 1 || progress.folders == 0 || progress.readed != progress.folders {
+		T.Errorf("Unexpected progress %+v", progress)
+	}
+}
+
+/*
+TestConcurrentUnpack tests, that the unpackings, running at the same time,
+write the same files as the sequential ones. Run with -race to check, that
+they share no state.
+*/
+func TestConcurrentUnpack(T *testing.T) {
+	inputs := []string{
+		`../../../test/testdata/simplecontainer`,
+		`../../../test/testdata/nestedcontainer`,
+		`../../../test/testdata/mixedfolder`,
+	}
+
+	type job struct {
+		archive  []byte
+		options  Options
+		expected map[string]string
+	}
+	jobs := make([]job, 0)
+	for _, input := range inputs {
+		var archive bytes.Buffer
+		err := packer.PackTo(context.Background(), input, &archive, packer.Options{ClassTransform: true, Dictionary: true})
+		if err != nil {
+			T.Fatal(err)
+		}
+		for _, options := range []Options{{}, {Unwrap: true}} {
+			sink := newMemSink()
+			r := bytes.NewReader(archive.Bytes())
+			err = UnpackFrom(context.Background(), r, r.Size(), sink, options)
+			if err != nil {
+				T.Fatal(err)
+			}
+			jobs = append(jobs, job{archive.Bytes(), options, sinkContents(sink)})
+		}
+	}
+
+	const repeats = 2
+	var wg sync.WaitGroup
+	errs := make([]error, len(jobs)*repeats)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			j := jobs[i%len(jobs)]
+			progress := &progressUI{JrepackUI: ui.Default()}
+			options := j.options
+			options.UI = progress
+
+			sink := newMemSink()
+			r := bytes.NewReader(j.archive)
+			err := UnpackFrom(context.Background(), r, r.Size(), sink, options)
+			switch {
+			case err != nil:
+				errs[i] = err
+			case !reflect.DeepEqual(sinkContents(sink), j.expected):
+				errs[i] = fmt.Errorf("Unpacked files %v differ from the sequential ones %v", sinkContents(sink), j.expected)
+			case progress.done != 1 || progress.readed == 0:
+				errs[i] = fmt.Errorf("Unexpected progress: %d done events, %d of %d folders", progress.done, progress.readed, progress.folders)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			T.Error(err)
+		}
+	}
+}
+
+// unpackContents will unpack the archive file into memory
+func unpackContents(T *testing.T, filename string) map[string]string {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	sink := newMemSink()
+	err = UnpackFrom(context.Background(), bytes.NewReader(b), int64(len(b)), sink, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+	return sinkContents(sink)
+}
+
+func TestUnpackLegacy(T *testing.T) {
+	// legacy.jre is packed by the packer of the format before trailer from
+	// mixedfolder and zerosize
+	files := make(map[string]string)
+	for _, dir := range []string{"mixedfolder", "zerosize"} {
+		root := "../../../test/testdata/" + dir
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			name, _ := filepath.Rel(root, path)
+			if dir == "zerosize" {
+				name = filepath.Join(dir, name)
+			}
+			files[filepath.ToSlash(name)] = string(b)
+			return nil
+		})
+		if err != nil {
+			T.Fatal(err)
+		}
+	}
+	expected := unpackContents(T, packTree(T, "legacy", files))
+	defer dropTree("legacy")
+
+	contents := unpackContents(T, "../../../test/testdata/legacy.jre")
+	if !reflect.DeepEqual(contents, expected) {
+		T.Errorf("Unexpected legacy contents %v, expected %v", contents, expected)
+	}
+}
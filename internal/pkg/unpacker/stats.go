@@ -0,0 +1,288 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+const (
+	// DuplicateGroups is the number of the largest duplicate groups in stats
+	DuplicateGroups = 20
+)
+
+// DuplicateGroup is the set of the files with the same data
+type DuplicateGroup struct {
+	Hash   string   `json:"hash"`
+	Size   uint32   `json:"size"`
+	Saved  int64    `json:"saved"`
+	Paths  []string `json:"paths"`
+	offset uint32
+}
+
+// ContainerStats is the deduplication of the container entries. Saved bytes
+// are the data of the entries, stored once for the other files.
+type ContainerStats struct {
+	Path       string `json:"path"`
+	Files      int    `json:"files"`
+	TotalBytes int64  `json:"totalBytes"`
+	SavedBytes int64  `json:"savedBytes"`
+}
+
+// GroupStats is the size of the files of one extension or one top-level folder.
+// Packed size of the data is estimated by its share of the data segment.
+type GroupStats struct {
+	Name        string `json:"name"`
+	Files       int    `json:"files"`
+	TotalBytes  int64  `json:"totalBytes"`
+	UniqueBytes int64  `json:"uniqueBytes"`
+	PackedBytes int64  `json:"packedBytes"`
+}
+
+// Stats is the deduplication and compression statistics of the archive
+type Stats struct {
+	Archive     string           `json:"archive"`
+	Files       int              `json:"files"`
+	TotalBytes  int64            `json:"totalBytes"`
+	Blobs       int              `json:"blobs"`
+	UniqueBytes int64            `json:"uniqueBytes"`
+	PackedBytes int64            `json:"packedBytes"`
+	Duplicates  []DuplicateGroup `json:"duplicates"`
+	Containers  []ContainerStats `json:"containers"`
+	Extensions  []GroupStats     `json:"extensions"`
+	Folders     []GroupStats     `json:"folders"`
+}
+
+// ReadStats will calculate statistics of the archive from its header,
+// data segments are not decoded
+func ReadStats(inputFile string, options Options) (*Stats, error) {
+	header, err := readArchLimited(inputFile, &options.Limits, options.Password)
+	if err != nil {
+		return nil, err
+	}
+	s := headerStats(header)
+	s.Archive = inputFile
+	return s, nil
+}
+
+// packedSizes will estimate packed size of every data record by its share of the segment
+func packedSizes(header *common.Header) map[uint32]int64 {
+	packed := make(map[uint32]int64, len(header.Data))
+	next := 0
+	for _, s := range header.Segments {
+		end := s.Offset + s.Size
+		for ; next < len(header.Data) && header.Data[next].Offset < end; next++ {
+			d := header.Data[next]
+			if s.Size > 0 {
+				packed[d.Offset] = int64(d.Size) * int64(s.Packed) / int64(s.Size)
+			}
+		}
+	}
+	return packed
+}
+
+func headerStats(header *common.Header) *Stats {
+	s := &Stats{
+		Blobs:       len(header.Data),
+		UniqueBytes: int64(header.Size),
+		Duplicates:  make([]DuplicateGroup, 0),
+		Containers:  make([]ContainerStats, 0),
+	}
+	for _, seg := range header.Segments {
+		s.PackedBytes += int64(seg.Packed)
+	}
+	packed := packedSizes(header)
+	data := make(map[uint32]*common.DataRecord, len(header.Data))
+	for _, d := range header.Data {
+		data[d.Offset] = d
+	}
+
+	extensions := make(map[string]*GroupStats)
+	folders := make(map[string]*GroupStats)
+	containers := make(map[string]*ContainerStats)
+	groups := make(map[uint32]*DuplicateGroup)
+
+	for i, folder := range header.Folders {
+		id := uint32(i + 1)
+		if folder.Flags == common.FArchive {
+			p := header.FullPath(id)
+			containers[p] = &ContainerStats{Path: p}
+			continue
+		}
+		if folder.Flags != common.FData {
+			continue
+		}
+
+		p := header.FullPath(id)
+		var size uint32
+		var hash []byte
+		if d, ok := data[folder.Data]; ok {
+			size = d.Size
+			hash = d.Hash
+		}
+		s.Files++
+		s.TotalBytes += int64(size)
+
+		// data is stored once, for the first file in the header order
+		first := true
+		if folder.Data != common.NoData {
+			g, ok := groups[folder.Data]
+			if !ok {
+				g = &DuplicateGroup{Hash: hex.EncodeToString(hash), Size: size, offset: folder.Data}
+				groups[folder.Data] = g
+			} else {
+				first = false
+				g.Saved += int64(size)
+			}
+			g.Paths = append(g.Paths, p)
+		}
+
+		add := func(groupStats map[string]*GroupStats, name string) {
+			g, ok := groupStats[name]
+			if !ok {
+				g = &GroupStats{Name: name}
+				groupStats[name] = g
+			}
+			g.Files++
+			g.TotalBytes += int64(size)
+			if first {
+				g.UniqueBytes += int64(size)
+				g.PackedBytes += packed[folder.Data]
+			}
+		}
+		ext := strings.ToLower(path.Ext(p))
+		if ext == "" {
+			ext = "(none)"
+		}
+		add(extensions, ext)
+		top := "/"
+		if i := strings.Index(p, "/"); i >= 0 {
+			top = p[:i]
+		}
+		add(folders, top)
+
+		// the closest container of the file
+		for id := folder.Parent; id > 0 && id <= uint32(len(header.Folders)); id = header.Folders[id-1].Parent {
+			if header.Folders[id-1].Flags == common.FArchive {
+				c := containers[header.FullPath(id)]
+				if c != nil {
+					c.Files++
+					c.TotalBytes += int64(size)
+					if !first {
+						c.SavedBytes += int64(size)
+					}
+				}
+				break
+			}
+		}
+	}
+
+	for _, g := range groups {
+		if len(g.Paths) > 1 {
+			s.Duplicates = append(s.Duplicates, *g)
+		}
+	}
+	sort.Slice(s.Duplicates, func(i, j int) bool {
+		if s.Duplicates[i].Saved != s.Duplicates[j].Saved {
+			return s.Duplicates[i].Saved > s.Duplicates[j].Saved
+		}
+		return s.Duplicates[i].offset < s.Duplicates[j].offset
+	})
+	if len(s.Duplicates) > DuplicateGroups {
+		s.Duplicates = s.Duplicates[:DuplicateGroups]
+	}
+
+	for _, c := range containers {
+		s.Containers = append(s.Containers, *c)
+	}
+	sort.Slice(s.Containers, func(i, j int) bool {
+		if s.Containers[i].SavedBytes != s.Containers[j].SavedBytes {
+			return s.Containers[i].SavedBytes > s.Containers[j].SavedBytes
+		}
+		return s.Containers[i].Path < s.Containers[j].Path
+	})
+	s.Extensions = sortedGroups(extensions)
+	s.Folders = sortedGroups(folders)
+	return s
+}
+
+// sortedGroups will sort groups by packed size, largest first
+func sortedGroups(groups map[string]*GroupStats) []GroupStats {
+	list := make([]GroupStats, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, *g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].PackedBytes != list[j].PackedBytes {
+			return list[i].PackedBytes > list[j].PackedBytes
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func (s *Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Archive: %s\n", s.Archive)
+	fmt.Fprintf(&b, "Files: %d, total: %d bytes\n", s.Files, s.TotalBytes)
+	fmt.Fprintf(&b, "Unique: %d blobs, %d bytes, saved by deduplication: %d bytes\n", s.Blobs, s.UniqueBytes, s.TotalBytes-s.UniqueBytes)
+	fmt.Fprintf(&b, "Packed: %d bytes (%s of unique)\n", s.PackedBytes, percent(s.PackedBytes, s.UniqueBytes))
+
+	if len(s.Duplicates) > 0 {
+		b.WriteString("\nLargest duplicate groups:\n")
+		for _, g := range s.Duplicates {
+			fmt.Fprintf(&b, "  %d copies of %d bytes, saved %d bytes:\n", len(g.Paths), g.Size, g.Saved)
+			for _, p := range g.Paths {
+				fmt.Fprintf(&b, "    %s\n", p)
+			}
+		}
+	}
+	if len(s.Containers) > 0 {
+		b.WriteString("\nContainers:\n")
+		fmt.Fprintf(&b, "  %12s %12s %8s  %s\n", "total", "saved", "files", "path")
+		for _, c := range s.Containers {
+			fmt.Fprintf(&b, "  %12d %12d %8d  %s\n", c.TotalBytes, c.SavedBytes, c.Files, c.Path)
+		}
+	}
+	writeGroups(&b, "Extensions", s.Extensions)
+	writeGroups(&b, "Top-level folders", s.Folders)
+	return b.String()
+}
+
+func writeGroups(b *strings.Builder, title string, groups []GroupStats) {
+	fmt.Fprintf(b, "\n%s:\n", title)
+	fmt.Fprintf(b, "  %12s %12s %12s %8s  %s\n", "packed", "unique", "total", "files", "name")
+	for _, g := range groups {
+		fmt.Fprintf(b, "  %12d %12d %12d %8d  %s\n", g.PackedBytes, g.UniqueBytes, g.TotalBytes, g.Files, g.Name)
+	}
+}
+
+func percent(a, b int64) string {
+	if b == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(a)*100/float64(b))
+}
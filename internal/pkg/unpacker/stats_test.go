@@ -0,0 +1,109 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
+)
+
+func TestStats(T *testing.T) {
+	filename := packTree(T, "stats", map[string]string{
+		"bin/java":               "java launcher",
+		"bin/javaw":              "java launcher",
+		"lib/a.jar/A.class":      "class A",
+		"lib/a.jar/B.class":      "shared class",
+		"lib/b.jar/B.class":      "shared class",
+		"lib/b.jar/C.class":      "class C",
+		"lib/security/certs":     "certificates",
+		"lib/security/certs.pem": "certificates",
+		"release":                "JAVA_VERSION=1.8",
+	})
+	defer dropTree("stats")
+
+	s, err := ReadStats(filename, Options{Limits: common.DefaultLimits})
+	if err != nil {
+		T.Fatal(err)
+	}
+	if s.Files != 9 {
+		T.Errorf("Files: %d", s.Files)
+	}
+	if s.Blobs != 6 || s.TotalBytes-s.UniqueBytes != int64(len("java launcher")+len("shared class")+len("certificates")) {
+		T.Errorf("Blobs: %d, total: %d, unique: %d", s.Blobs, s.TotalBytes, s.UniqueBytes)
+	}
+	if s.PackedBytes == 0 {
+		T.Error("Packed size is not calculated")
+	}
+
+	if len(s.Duplicates) != 3 {
+		T.Fatalf("Duplicates: %+v", s.Duplicates)
+	}
+	if g := s.Duplicates[0]; g.Saved != int64(len("java launcher")) || len(g.Paths) != 2 || g.Paths[0] != "bin/java" {
+		T.Errorf("Largest duplicate group: %+v", g)
+	}
+
+	saved := make(map[string]int64)
+	for _, c := range s.Containers {
+		saved[c.Path] = c.SavedBytes
+		if c.Files != 2 {
+			T.Errorf("Container %s files: %d", c.Path, c.Files)
+		}
+	}
+	if len(saved) != 2 || saved["lib/a.jar"]+saved["lib/b.jar"] != int64(len("shared class")) {
+		T.Errorf("Containers: %+v", s.Containers)
+	}
+
+	var packed, unique int64
+	names := make(map[string]bool)
+	for _, g := range s.Extensions {
+		packed += g.PackedBytes
+		unique += g.UniqueBytes
+		names[g.Name] = true
+	}
+	if !names[".class"] || !names[".pem"] || !names["(none)"] || unique != s.UniqueBytes {
+		T.Errorf("Extensions: %+v", s.Extensions)
+	}
+	if packed > s.PackedBytes {
+		T.Errorf("Packed by extensions: %d > %d", packed, s.PackedBytes)
+	}
+	folders := make(map[string]int)
+	for _, g := range s.Folders {
+		folders[g.Name] = g.Files
+	}
+	if folders["bin"] != 2 || folders["lib"] != 6 || folders["/"] != 1 {
+		T.Errorf("Folders: %+v", s.Folders)
+	}
+
+	text := s.String()
+	if !strings.Contains(text, "bin/javaw") || !strings.Contains(text, "lib/b.jar") {
+		T.Errorf("Stats text:\n%s", text)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		T.Fatal(err)
+	}
+	var decoded Stats
+	if err := json.Unmarshal(b, &decoded); err != nil || decoded.Files != s.Files || len(decoded.Duplicates) != 3 {
+		T.Errorf("Stats json: %s", b)
+	}
+}
@@ -23,18 +23,88 @@ Package unpacker is the package for uncompress functions
 package unpacker
 
 import (
+	"context"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	common "github.com/alexript/jrepack/internal/pkg/common"
 	"github.com/alexript/jrepack/ui"
 )
 
+// Options is the set of the unpacking options.
+type Options struct {
+	// Lenient will write files with the wrong hash summ and report them
+	// after unpacking, instead of the unpacking failure. Damaged archive
+	// with the checked signature is refused anyway.
+	Lenient bool
+
+	// Limits are checked while the header is read and while the data is decoded
+	Limits Limits
+
+	// PublicKeys are the trusted keys of the archive signature
+	PublicKeys []ed25519.PublicKey
+
+	// RequireSignature will refuse the unsigned archives
+	RequireSignature bool
+
+	// SignatureFile is the detached signature, archive file name + ".sig" is used by default
+	SignatureFile string
+
+	// Password is the password of the encrypted archive
+	Password string
+
+	// Select will unpack only the selected entries, nil selects everything
+	Select *Selector
+
+	// Unwrap will write entries of the containers as the files of the folder
+	// with the container name, instead of the rebuilt container
+	Unwrap bool
+
+	// UI receives the progress of the unpacking, current UI is used when nil
+	UI ui.JrepackUI
+}
+
+// progress will return UI of the unpacking
+func (options *Options) progress() ui.JrepackUI {
+	if options.UI != nil {
+		return options.UI
+	}
+	return ui.Current()
+}
+
+// Limits is the set of the resource limits for the untrusted archives.
+// Zero limit means no limit.
+type Limits = common.Limits
+
+// HashError is the error for the unpacked files, which data do not match the hash summ.
+type HashError struct {
+	Paths []string
+}
+
+func (e *HashError) Error() string {
+	return fmt.Sprintf("Hash summ mismatch: %s", strings.Join(e.Paths, ", "))
+}
+
 // UnPack is the entry pint of the package
 func UnPack(inputFile, outputFolder string) error {
+	return UnPackWithOptions(inputFile, outputFolder, Options{})
+}
+
+// UnPackWithOptions is the uncompressing with the given options.
+func UnPackWithOptions(inputFile, outputFolder string, options Options) error {
+	return UnPackContext(context.Background(), inputFile, outputFolder, options)
+}
+
+// UnPackContext is UnPackWithOptions, which is stopped, when the context is
+// done. Output folder is removed on failure, so the canceled unpacking returns
+// context error and leaves nothing behind.
+func UnPackContext(ctx context.Context, inputFile, outputFolder string, options Options) error {
 	input, err := filepath.Abs(inputFile)
 	if err != nil {
 		return err
@@ -56,24 +126,75 @@ func UnPack(inputFile, outputFolder string) error {
 		return errors.New("Output folder exists")
 	}
 
-	header, err := readArch(inputFile)
+	f, err := os.Open(input)
+	if err != nil {
+		return fmt.Errorf("Unable to open archive file: %v", err)
+	}
+	defer f.Close()
 
+	defaultSignatureFile(input, &options)
+	err = UnpackFrom(ctx, f, ifi.Size(), DirSink(output), options)
 	if err != nil {
+		var hashErr *HashError
+		if options.Lenient && errors.As(err, &hashErr) {
+			// all files are written, broken ones are reported
+			return err
+		}
 		_ = common.RemoveDirReq(output)
-		return fmt.Errorf("Unable to read compressed header: %v", err)
 	}
+	return err
+}
 
-	err = Decompress(header, inputFile, output)
-	header = nil
-	runtime.GC()
+/*
+UnpackFrom will unpack the archive of the given size into the sink. Detached
+signature is read only from options.SignatureFile. Archive checksum is verified
+before unpacking, unless options.Lenient is set and the signature is not
+checked. Context is checked between the
+files and the read blocks, files, already written into the sink, are left.
+*/
+func UnpackFrom(ctx context.Context, r io.ReaderAt, size int64, sink Sink, options Options) error {
+	err := ctx.Err()
 	if err != nil {
-		_ = common.RemoveDirReq(output)
-		return fmt.Errorf("Unable to decompress header: %v", err)
+		return err
+	}
+	signed, err := checkSignature(r, size, &options)
+	if err != nil {
+		return err
+	}
+
+	trailer, header, key, err := readHeader(r, size, &options.Limits, options.Password)
+	if err != nil {
+		return fmt.Errorf("Unable to read compressed header: %w", err)
 	}
 
-	if err == nil {
-		ui.Current().OnEnd(ui.EvtUnpackDone)
+	if !options.Lenient || signed {
+		// in lenient mode damaged files are reported by the hash summ, but
+		// the signature covers only the trailer, so the signed archive is
+		// trusted by its checksum
+		err = trailer.VerifyArchive(r)
+		if err != nil {
+			return err
+		}
 	}
 
-	return err
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
+	err = decompress(ctx, header, key, r, size, sink, options)
+	header = nil
+	runtime.GC()
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		var hashErr *HashError
+		if options.Lenient && errors.As(err, &hashErr) {
+			return err
+		}
+		return fmt.Errorf("Unable to decompress header: %w", err)
+	}
+
+	options.progress().OnEnd(ui.EvtUnpackDone)
+	return nil
 }
@@ -20,12 +20,22 @@
 package unpacker
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/alexript/jrepack/internal/pkg/common"
 	"github.com/alexript/jrepack/internal/pkg/packer"
+	"github.com/alexript/jrepack/ui"
 )
 
 const (
@@ -76,3 +86,467 @@ func TestUnpacker(T *testing.T) {
 		T.Fatal(err)
 	}
 }
+
+func readZipEntries(T *testing.T, filename string) map[string][]byte {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer r.Close()
+
+	entries := make(map[string][]byte)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			T.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			T.Fatal(err)
+		}
+		entries[f.Name] = b
+	}
+	return entries
+}
+
+func TestUnpackClassTransform(T *testing.T) {
+	inputFolder := `../../../test/testdata/classfiles`
+	filename := "../../../test/output/classtest.dat"
+	root, _ := filepath.Abs(outputDirRootTest)
+	dirName := filepath.Join(root, "classfiles")
+	f, _ := filepath.Abs(filename)
+	os.Remove(f)
+	common.RemoveDirReq(dirName)
+	defer os.Remove(f)
+	defer common.RemoveDirReq(dirName)
+
+	err := packer.PackWithOptions(inputFolder, filename, packer.Options{ClassTransform: true})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	header, err := readArch(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	transformed := false
+	for _, s := range header.Segments {
+		if s.Transform == common.TransformClass {
+			transformed = true
+		}
+	}
+	if !transformed {
+		T.Error("No classes segment in archive")
+	}
+
+	err = UnPack(filename, dirName)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	for _, name := range []string{"Hello.class", "Counter.class"} {
+		expected, _ := ioutil.ReadFile(filepath.Join(inputFolder, name))
+		result, err := ioutil.ReadFile(filepath.Join(dirName, name))
+		if err != nil {
+			T.Fatal(err)
+		}
+		if !bytes.Equal(expected, result) {
+			T.Errorf("Class %s is not restored", name)
+		}
+	}
+
+	expected := readZipEntries(T, filepath.Join(inputFolder, "example.jar"))
+	result := readZipEntries(T, filepath.Join(dirName, "example.jar"))
+	if len(result) != len(expected) {
+		T.Errorf("Jar has %d entries, expected %d", len(result), len(expected))
+	}
+	for name, b := range expected {
+		r, ok := result[name]
+		if !ok {
+			T.Errorf("Jar entry %s is missing", name)
+		} else if !bytes.Equal(b, r) {
+			T.Errorf("Jar entry %s is not restored", name)
+		}
+	}
+}
+
+// nativeSample is the fake x86-64 ELF library with plenty of calls
+func nativeSample() []byte {
+	b := make([]byte, 64*1024)
+	copy(b, "\x7fELF\x02\x01\x01")
+	binary.LittleEndian.PutUint16(b[18:], 0x3E)
+	for pos := 64; pos+5 <= len(b); pos += 8 {
+		b[pos] = 0xE8
+		binary.LittleEndian.PutUint32(b[pos+1:], uint32(4096-pos))
+	}
+	return b
+}
+
+func TestUnpackBranchFilter(T *testing.T) {
+	files := map[string]string{"lib/libjvm.so": string(nativeSample())}
+	filename := packTreeWithOptions(T, "native", files, packer.Options{BranchFilter: true})
+	defer dropTree("native")
+
+	header, err := readArch(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if len(header.Data) != 1 || header.Data[0].Filter == 0 {
+		T.Errorf("Filter is not recorded in header: %v", header.Data)
+	}
+
+	dirName := filepath.Join(treeRoot("native"), "out")
+	err = UnPack(filename, dirName)
+	if err != nil {
+		T.Fatal(err)
+	}
+	checkTree(T, dirName, files)
+}
+
+func TestUnpackDictionary(T *testing.T) {
+	// already compressed resources with the common header, frames are kept,
+	// because LZMA does not compress them better
+	rnd := rand.New(rand.NewSource(3))
+	files := make(map[string]string)
+	for i := 0; i < 64; i++ {
+		b := make([]byte, 16*1024)
+		rnd.Read(b)
+		files[fmt.Sprintf("lib/res%02d.bin", i)] = fmt.Sprintf("# Copyright (c) Oracle and/or its affiliates. All rights reserved.\n# DO NOT ALTER OR REMOVE COPYRIGHT NOTICES OR THIS FILE HEADER.\nresource.id=%d\n%s", i, b)
+	}
+	files["lib/big.dat"] = strings.Repeat("big data file ", 4096)
+	filename := packTreeWithOptions(T, "dict", files, packer.Options{Dictionary: true})
+	defer dropTree("dict")
+
+	header, err := readArch(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if len(header.Dictionary) == 0 {
+		T.Error("No dictionary in archive")
+	}
+	frames := 0
+	for _, s := range header.Segments {
+		if s.Codec == common.CodecDeflateDict {
+			frames++
+		}
+	}
+	if frames < 2 {
+		T.Errorf("Unexpected number of frames %d", frames)
+	}
+
+	dirName := filepath.Join(treeRoot("dict"), "out")
+	err = UnPack(filename, dirName)
+	if err != nil {
+		T.Fatal(err)
+	}
+	checkTree(T, dirName, files)
+}
+
+func TestUnpackAuto(T *testing.T) {
+	// already compressed image is not compressible
+	image := make([]byte, 128*1024)
+	rand.New(rand.NewSource(1)).Read(image)
+	copy(image, "\x89PNG\r\n\x1a\n")
+
+	files := map[string]string{
+		"lib/libjvm.so":       string(nativeSample()),
+		"lib/images/logo.png": string(image),
+		"lib/text.txt":        strings.Repeat("plain text file\n", 4096),
+	}
+	filename := packTreeWithOptions(T, "auto", files, packer.Options{Auto: true})
+	defer dropTree("auto")
+
+	header, err := readArch(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if len(header.Segments) != 3 {
+		T.Fatalf("Unexpected number of segments %d", len(header.Segments))
+	}
+	stored := 0
+	for _, s := range header.Segments {
+		if s.Codec == common.CodecStore {
+			stored++
+		}
+	}
+	if stored != 1 {
+		T.Errorf("Unexpected number of stored segments %d", stored)
+	}
+	filtered := 0
+	for _, d := range header.Data {
+		if d.Filter != 0 {
+			filtered++
+		}
+	}
+	if filtered != 1 {
+		T.Errorf("Unexpected number of filtered files %d", filtered)
+	}
+
+	dirName := filepath.Join(treeRoot("auto"), "out")
+	err = UnPack(filename, dirName)
+	if err != nil {
+		T.Fatal(err)
+	}
+	checkTree(T, dirName, files)
+}
+
+func TestUnpackHashMismatch(T *testing.T) {
+	// random data is stored uncompressed, so it can be corrupted silently
+	image := make([]byte, 4096)
+	rand.New(rand.NewSource(2)).Read(image)
+	copy(image, "\x89PNG\r\n\x1a\n")
+	filename := packTreeWithOptions(T, "hash", map[string]string{
+		"lib/logo.png": string(image),
+		"text.txt":     "plain text",
+	}, packer.Options{Auto: true})
+	defer dropTree("hash")
+	dirName := filepath.Join(treeRoot("hash"), "out")
+
+	header, err := readArch(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	position := int64(-1)
+	for i, s := range header.Segments {
+		if s.Codec == common.CodecStore {
+			position = 0
+			for _, p := range header.Segments[:i] {
+				position += int64(p.Packed)
+			}
+		}
+	}
+	if position < 0 {
+		T.Fatal("No stored segment in archive")
+	}
+	archive, err := os.OpenFile(filename, os.O_RDWR, 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+	_, err = archive.WriteAt([]byte{image[100] ^ 0xFF}, position+100)
+	archive.Close()
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	err = UnPack(filename, dirName)
+	if !errors.Is(err, common.ErrCorrupted) {
+		T.Fatalf("Unexpected error %v", err)
+	}
+	if _, err := os.Stat(dirName); !os.IsNotExist(err) {
+		T.Error("Output folder is created")
+	}
+
+	err = Decompress(header, filename, dirName)
+	var hashErr *HashError
+	if !errors.As(err, &hashErr) {
+		T.Fatalf("Unexpected error %v", err)
+	}
+	if len(hashErr.Paths) != 1 || hashErr.Paths[0] != "lib/logo.png" {
+		T.Errorf("Unexpected paths %v", hashErr.Paths)
+	}
+	common.RemoveDirReq(dirName)
+
+	err = UnPackWithOptions(filename, dirName, Options{Lenient: true})
+	if !errors.As(err, &hashErr) {
+		T.Fatalf("Unexpected error %v", err)
+	}
+	if len(hashErr.Paths) != 1 || hashErr.Paths[0] != "lib/logo.png" {
+		T.Errorf("Unexpected paths %v", hashErr.Paths)
+	}
+	result, err := ioutil.ReadFile(filepath.Join(dirName, "text.txt"))
+	if err != nil || string(result) != "plain text" {
+		T.Errorf("Valid file is not restored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dirName, "lib", "logo.png")); err != nil {
+		T.Errorf("Broken file is not written in lenient mode: %v", err)
+	}
+}
+
+func TestUnpackDamaged(T *testing.T) {
+	err := prepareTestData()
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer dropTestData()
+	root, _ := filepath.Abs(outputDirRootTest)
+	dirName := filepath.Join(root, outputDirNameTest)
+	damagedName := "../../../test/output/damagedtest.dat"
+	defer os.Remove(damagedName)
+
+	b, err := ioutil.ReadFile(filenameTest)
+	if err != nil {
+		T.Fatal(err)
+	}
+	size := trailerSize()
+
+	cases := map[string][]byte{
+		"truncated":        b[:len(b)/2],
+		"no trailer":       b[:len(b)-size],
+		"extra data":       append(append([]byte(nil), b...), 0),
+		"damaged header":   flipByte(b, len(b)-size-10),
+		"damaged data":     flipByte(b, 10),
+		"damaged checksum": flipByte(b, len(b)-20),
+	}
+	for name, data := range cases {
+		err = ioutil.WriteFile(damagedName, data, 0666)
+		if err != nil {
+			T.Fatal(err)
+		}
+		err = UnPack(damagedName, dirName)
+		if !errors.Is(err, common.ErrCorrupted) {
+			T.Errorf("Archive with %s: unexpected error %v", name, err)
+		}
+		common.RemoveDirReq(dirName)
+	}
+}
+
+// trailerSize is the size of the trailer of the current format
+func trailerSize() int {
+	return int(common.NewTrailer(0, nil).Size())
+}
+
+func flipByte(b []byte, pos int) []byte {
+	damaged := append([]byte(nil), b...)
+	damaged[pos] ^= 0xFF
+	return damaged
+}
+
+func TestVerify(T *testing.T) {
+	err := prepareTestData()
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer dropTestData()
+
+	report, err := Verify(filenameTest)
+	if err != nil {
+		T.Fatal(err)
+	}
+	T.Logf("Report: %v", report)
+	if !report.OK() {
+		T.Errorf("Unexpected problems %v", report.Problems)
+	}
+}
+
+func TestVerifyDamaged(T *testing.T) {
+	err := prepareTestData()
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer dropTestData()
+	damagedName := "../../../test/output/damagedverify.dat"
+	defer os.Remove(damagedName)
+
+	b, err := ioutil.ReadFile(filenameTest)
+	if err != nil {
+		T.Fatal(err)
+	}
+	cases := map[string][]byte{
+		"truncated":    b[:len(b)-1],
+		"damaged data": flipByte(b, 10),
+	}
+	for name, data := range cases {
+		err = ioutil.WriteFile(damagedName, data, 0666)
+		if err != nil {
+			T.Fatal(err)
+		}
+		report, err := Verify(damagedName)
+		if err != nil {
+			T.Fatal(err)
+		}
+		if report.OK() || !strings.Contains(report.String(), "Result: FAIL") {
+			T.Errorf("Archive with %s passed: %v", name, report)
+		}
+	}
+
+	_, err = Verify(damagedName + ".missing")
+	if err == nil {
+		T.Error("Missing archive verified")
+	}
+}
+
+func TestCheckFolders(T *testing.T) {
+	h := common.NewHeader(20)
+	h.Pack(0, 10, make([]byte, 32))
+	h.Pack(10, 10, make([]byte, 32))
+	h.Folders = common.FoldersHeader{
+		{Parent: 0, Flags: common.FFolder, Data: common.NoData, Name: []byte("_root_")},
+		{Parent: 1, Flags: common.FData, Data: 10, Name: []byte("used")},
+		{Parent: 1, Flags: common.FData, Data: common.NoData, Name: []byte("empty")},
+	}
+
+	report := &Report{}
+	checkFolders(h, report)
+	if report.Files != 2 {
+		T.Errorf("Unexpected number of files %d", report.Files)
+	}
+	if len(report.Problems) != 1 || !strings.Contains(report.Problems[0], "offset 0") {
+		T.Errorf("Unexpected problems %v", report.Problems)
+	}
+}
+
+// cancelUI cancels the unpacking, when the first file is unpacked
+type cancelUI struct {
+	ui.JrepackUI
+	cancel context.CancelFunc
+}
+
+func (c *cancelUI) Unpack(readedFolders, foldersNum int) {
+	c.cancel()
+}
+
+func TestUnPackContext(T *testing.T) {
+	err := prepareTestData()
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer dropTestData()
+
+	root, _ := filepath.Abs(outputDirRootTest)
+	dirName := filepath.Join(root, outputDirNameTest)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = UnPackContext(ctx, filenameTest, dirName, Options{UI: &cancelUI{JrepackUI: ui.Default(), cancel: cancel}})
+	cancel()
+	if !errors.Is(err, context.Canceled) {
+		T.Fatalf("Unexpected error %v", err)
+	}
+	if _, err := os.Stat(dirName); !os.IsNotExist(err) {
+		T.Error("Partial output folder is left")
+	}
+
+	// data segments are not decoded after cancel
+	f, err := os.Open(filenameTest)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		T.Fatal(err)
+	}
+	_, header, _, err := readHeader(f, fi.Size(), &common.Limits{}, "")
+	if err != nil {
+		T.Fatal(err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	readed, err := readBlobs(ctx, header, nil, f, &common.Limits{}, nil, func(*common.DataRecord, []byte) error {
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || readed != 0 {
+		T.Errorf("Canceled reading: %d bytes, %v", readed, err)
+	}
+
+	err = DecompressContext(ctx, header, filenameTest, dirName, Options{})
+	if !errors.Is(err, context.Canceled) {
+		T.Errorf("Unexpected error %v", err)
+	}
+	common.RemoveDirReq(dirName)
+
+	err = UnPackContext(context.Background(), filenameTest, dirName, Options{})
+	if err != nil {
+		T.Fatal(err)
+	}
+}
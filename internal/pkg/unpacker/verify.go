@@ -0,0 +1,199 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package unpacker
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	common "github.com/alexript/jrepack/internal/pkg/common"
+)
+
+// Report is the result of the archive verification
+type Report struct {
+	Archive   string
+	Files     int
+	Blobs     int
+	Size      int64
+	Signer    string
+	Encrypted bool
+	Problems  []string
+}
+
+// OK is true, when no problems are found
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *Report) problem(format string, a ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, a...))
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Archive: %s\n", r.Archive)
+	fmt.Fprintf(&b, "Files: %d, data blobs: %d, data size: %d bytes\n", r.Files, r.Blobs, r.Size)
+	if r.Encrypted {
+		b.WriteString("Encrypted: yes\n")
+	}
+	if r.Signer != "" {
+		fmt.Fprintf(&b, "Signed by: %s\n", r.Signer)
+	}
+	if r.OK() {
+		b.WriteString("Result: PASS\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Problems: %d\n", len(r.Problems))
+	for _, p := range r.Problems {
+		fmt.Fprintf(&b, "  %s\n", p)
+	}
+	b.WriteString("Result: FAIL\n")
+	return b.String()
+}
+
+/*
+Verify will check the archive without extracting it.
+
+Checksums, references of the folder records and segments are checked, all data
+segments are decoded and hash summ of every data record is checked. Damages
+are reported in the Report, error is returned only when the archive can not be read.
+*/
+func Verify(inputFile string) (*Report, error) {
+	return VerifyWithOptions(inputFile, Options{})
+}
+
+// VerifyWithLimits will check the archive, which is checked against the limits too.
+func VerifyWithLimits(inputFile string, limits Limits) (*Report, error) {
+	return VerifyWithOptions(inputFile, Options{Limits: limits})
+}
+
+// VerifyWithOptions will check the archive against the limits and the
+// signature options too.
+func VerifyWithOptions(inputFile string, options Options) (*Report, error) {
+	report := &Report{Archive: inputFile}
+	limits := options.Limits
+
+	if options.RequireSignature || len(options.PublicKeys) > 0 {
+		signer, err := VerifySignature(inputFile, options)
+		switch {
+		case err == nil:
+			report.Signer = hex.EncodeToString(signer)
+		case errors.Is(err, common.ErrUnsigned) && !options.RequireSignature:
+		default:
+			report.problem("%v", err)
+		}
+	}
+
+	trailer, header, key, err := readArchive(inputFile, &limits, options.Password)
+	var validationErr *common.ValidationError
+	if errors.As(err, &validationErr) {
+		report.Problems = append(report.Problems, validationErr.Problems...)
+		return report, nil
+	}
+	if errors.Is(err, common.ErrCorrupted) || errors.Is(err, common.ErrLimit) {
+		report.problem("%v", err)
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open archive file: %v", err)
+	}
+	defer f.Close()
+	report.Encrypted = key != nil
+	if err := trailer.VerifyArchive(f); err != nil {
+		report.problem("%v", err)
+	}
+
+	checkFolders(header, report)
+	checkSegments(header, trailer, report)
+
+	readed, err := readBlobs(context.Background(), header, key, f, &limits, nil, func(dataRecord *common.DataRecord, b []byte) error {
+		report.Blobs++
+		if !bytes.Equal(common.Hash(b), dataRecord.Hash) {
+			report.problem("Hash summ mismatch at offset %d: %s", dataRecord.Offset, strings.Join(dataPaths(header, dataRecord), ", "))
+		}
+		return nil
+	})
+	report.Size = readed
+	if err != nil {
+		report.problem("Unable to decode data: %v", err)
+	} else if readed != int64(header.Size) {
+		report.problem("Decoded data size is %d bytes, expected %d bytes", readed, header.Size)
+	}
+
+	return report, nil
+}
+
+// checkFolders will count files and check, that all data records are used.
+// References of the folder records are checked, when header is read.
+func checkFolders(header *common.Header, report *Report) {
+	data := make(map[uint32]bool, len(header.Data))
+	for _, folder := range header.Folders {
+		if folder.Flags == common.FData {
+			report.Files++
+			data[folder.Data] = true
+		}
+	}
+
+	for _, d := range header.Data {
+		if !data[d.Offset] {
+			report.problem("Data at offset %d is not used by any file", d.Offset)
+		}
+	}
+}
+
+// checkSegments will check, that data records and segments cover the whole data
+func checkSegments(header *common.Header, trailer *common.Trailer, report *Report) {
+	offset := uint32(0)
+	packed := int64(0)
+	for i, s := range header.Segments {
+		if s.Offset != offset {
+			report.problem("Segment %d starts at offset %d, expected %d", i, s.Offset, offset)
+		}
+		offset = s.Offset + s.Size
+		packed += int64(s.Packed)
+	}
+	if offset != header.Size {
+		report.problem("Segments size is %d bytes, expected %d bytes", offset, header.Size)
+	}
+	if packed != trailer.HeaderOffset() {
+		report.problem("Packed segments size is %d bytes, expected %d bytes", packed, trailer.HeaderOffset())
+	}
+
+	offset = 0
+	for _, d := range header.Data {
+		if d.Offset != offset {
+			report.problem("Data at offset %d, expected %d", d.Offset, offset)
+		}
+		offset = d.Offset + d.Size
+	}
+	if offset != header.Size {
+		report.problem("Data size is %d bytes, expected %d bytes", offset, header.Size)
+	}
+}
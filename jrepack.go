@@ -30,24 +30,338 @@ also cleans from double files.
 
 On uncompress, *.jre and *.zip files are created from scratch and their content
 are created.
+
+Optionally, java classes are grouped and split into separate streams (constants,
+bytecode and attributes) before compression. This transform is lossless.
+
+Optionally, small files are compressed in the small independent deflate frames
+with the shared dictionary, trained on the sample of the files. Frames are kept
+only when they are smaller than the LZMA stream of the same files.
+
+Optionally, the codec is selected automatically: files are grouped by kind
+(native libraries, already compressed media, other) and every data segment is
+compressed by several codecs, the smallest result is kept.
+
+On uncompress, hash summ of every file is checked. Files with the wrong hash
+summ fail the uncompress, or are reported in the lenient mode.
+
+Names of the archive entries are checked on uncompress, entries, which escape
+the output folder, fail the uncompress.
+
+Uncompress can be limited to the entries, selected by paths, globs or regular
+expressions. Entries of the containers are written into the rebuilt containers
+or as the plain files. Data segments without the selected files are not decoded.
+
+Resource limits (unpacked size, file size, number of entries, path depth and
+header size) can be set for the untrusted archives.
+
+Archives can be signed by the Ed25519 key. Signature covers the trailer, which
+contains checksums of the header and of the whole archive. Uncompress can
+require the signature of the trusted key.
+
+Archives can be encrypted by the password. Key is derived by scrypt, data
+segments and header are encrypted by AES-256-GCM, so the file names are hidden
+too. Key derivation parameters are stored in the trailer.
+
+Archives of the legacy format, made before the trailer was introduced, are
+still unpacked, listed and verified by the hashes of the files. They have no
+archive checksums, so they can not be signed or encrypted; repack them to get
+the current format.
+
+PackTo and UnpackFrom work with io.Writer and io.ReaderAt and are configured
+by the functional options:
+
+	err := jrepack.PackTo(ctx, "jre", w, jrepack.WithClassTransform(), jrepack.WithDictionary())
+
+	err = jrepack.UnpackFrom(ctx, r, size, jrepack.DirSink("out"), jrepack.WithLimits(jrepack.DefaultLimits))
+
+PackContext, UnPackContext, PackTo and UnpackFrom are stopped, when the context
+is done, and return the context error. PackContext and UnPackContext remove the
+partial output file or folder, the writer of PackTo and the sink of UnpackFrom
+are left to the caller.
+
+Packing and unpacking keep their state in the operation, so several archives
+can be packed and unpacked at the same time. Progress is reported into the UI
+of the options, every operation should have its own one.
 */
 package jrepack
 
 import (
+	"context"
+	"crypto/ed25519"
+
+	"github.com/alexript/jrepack/internal/pkg/common"
 	"github.com/alexript/jrepack/internal/pkg/packer"
 	"github.com/alexript/jrepack/internal/pkg/unpacker"
 )
 
 /*
-Pack is the only function for compressing.
+Pack is the only function for compressing. Progress is reported into the
+current UI, see ui.Set.
 */
 func Pack(inputFolder, outputFile string, dumpheader bool) error {
 	return packer.Pack(inputFolder, outputFile, dumpheader)
 }
 
 /*
-UnPack is the only function for uncompressing.
+PackOptions is the set of the packing options.
+*/
+type PackOptions = packer.Options
+
+/*
+DefaultAutoBudget is the default time budget of the codec selection for one data segment.
+*/
+const DefaultAutoBudget = packer.DefaultAutoBudget
+
+/*
+PackWithOptions is the compressing with the given options.
+*/
+func PackWithOptions(inputFolder, outputFile string, options PackOptions) error {
+	return packer.PackWithOptions(inputFolder, outputFile, options)
+}
+
+/*
+PackContext is PackWithOptions, which is stopped, when the context is done.
+Partial output file is removed.
+*/
+func PackContext(ctx context.Context, inputFolder, outputFile string, options PackOptions) error {
+	return packer.PackContext(ctx, inputFolder, outputFile, options)
+}
+
+/*
+UnPack is the only function for uncompressing. Progress is reported into the
+current UI, see ui.Set.
 */
 func UnPack(inputFile, outputFolder string) error {
 	return unpacker.UnPack(inputFile, outputFolder)
 }
+
+/*
+UnPackOptions is the set of the unpacking options.
+*/
+type UnPackOptions = unpacker.Options
+
+/*
+HashError is the error for the unpacked files, which data do not match the hash summ.
+*/
+type HashError = unpacker.HashError
+
+var (
+	// ErrCorrupted is the error for the truncated or damaged archive
+	ErrCorrupted = common.ErrCorrupted
+
+	// ErrUnsafePath is the error for the archive entries, which escape the output folder
+	ErrUnsafePath = unpacker.ErrUnsafePath
+
+	// ErrLimit is the error for the archive, which exceeds the resource limits
+	ErrLimit = common.ErrLimit
+
+	// DefaultLimits is the set of limits, sufficient for any JRE
+	DefaultLimits = common.DefaultLimits
+
+	// ErrUnsigned is the error for the archive without signature
+	ErrUnsigned = common.ErrUnsigned
+
+	// ErrSignature is the error for the wrong or untrusted signature
+	ErrSignature = common.ErrSignature
+
+	// ErrEncrypted is the error for the encrypted archive, opened without password
+	ErrEncrypted = common.ErrEncrypted
+
+	// ErrPassword is the error for the wrong password of the encrypted archive
+	ErrPassword = common.ErrPassword
+)
+
+/*
+Selector is the set of the patterns of the selective unpacking. Entry is
+selected, when it or any of its parent folders or containers matches.
+*/
+type Selector = unpacker.Selector
+
+/*
+Limits is the set of the resource limits for the untrusted archives.
+Zero limit means no limit.
+*/
+type Limits = unpacker.Limits
+
+/*
+UnPackWithOptions is the uncompressing with the given options.
+*/
+func UnPackWithOptions(inputFile, outputFolder string, options UnPackOptions) error {
+	return unpacker.UnPackWithOptions(inputFile, outputFolder, options)
+}
+
+/*
+UnPackContext is UnPackWithOptions, which is stopped, when the context is done.
+Partial output folder is removed.
+*/
+func UnPackContext(ctx context.Context, inputFile, outputFolder string, options UnPackOptions) error {
+	return unpacker.UnPackContext(ctx, inputFile, outputFolder, options)
+}
+
+/*
+VerifyReport is the result of the archive verification.
+*/
+type VerifyReport = unpacker.Report
+
+/*
+Verify will check the archive without extracting it.
+*/
+func Verify(inputFile string) (*VerifyReport, error) {
+	return unpacker.Verify(inputFile)
+}
+
+/*
+VerifyWithLimits will check the archive, which is checked against the limits too.
+*/
+func VerifyWithLimits(inputFile string, limits Limits) (*VerifyReport, error) {
+	return unpacker.VerifyWithLimits(inputFile, limits)
+}
+
+/*
+VerifyWithOptions will check the archive against the limits and the signature options too.
+*/
+func VerifyWithOptions(inputFile string, options UnPackOptions) (*VerifyReport, error) {
+	return unpacker.VerifyWithOptions(inputFile, options)
+}
+
+/*
+Entry is the file, folder or container of the archive.
+*/
+type Entry = unpacker.Entry
+
+/*
+List will read the archive header and return all entries, entries of the
+containers are listed too.
+*/
+func List(inputFile string, options UnPackOptions) ([]Entry, error) {
+	return unpacker.List(inputFile, options)
+}
+
+/*
+MatchEntries will return entries, which match the glob pattern. Pattern with
+slash is matched against the full path, otherwise against the name of the entry.
+*/
+func MatchEntries(entries []Entry, pattern string) ([]Entry, error) {
+	return unpacker.MatchEntries(entries, pattern)
+}
+
+/*
+SortBySize will sort entries by size, largest first.
+*/
+func SortBySize(entries []Entry) {
+	unpacker.SortBySize(entries)
+}
+
+/*
+AuditReport is the difference of the installed folder from the archive.
+*/
+type AuditReport = unpacker.AuditReport
+
+/*
+Audit will compare files of the installed folder, including entries of the
+containers, with the archive header. Nothing is written.
+*/
+func Audit(inputFile, folder string, options UnPackOptions) (*AuditReport, error) {
+	return unpacker.Audit(inputFile, folder, options)
+}
+
+/*
+Diff is the difference of the files of two archives.
+*/
+type Diff = unpacker.Diff
+
+/*
+DiffArchives will compare files of two archives, entries of the containers are
+compared too. Only headers are read, data segments are not decoded.
+*/
+func DiffArchives(oldFile, newFile string, options UnPackOptions) (*Diff, error) {
+	return unpacker.DiffArchives(oldFile, newFile, options)
+}
+
+/*
+Stats is the deduplication and compression statistics of the archive.
+*/
+type Stats = unpacker.Stats
+
+/*
+ReadStats will calculate deduplication and compression statistics of the
+archive from its header. Packed sizes of the files are estimated by their
+share of the data segments.
+*/
+func ReadStats(inputFile string, options UnPackOptions) (*Stats, error) {
+	return unpacker.ReadStats(inputFile, options)
+}
+
+/*
+Properties is the ordered list of the archive metadata, like properties of
+the JRE release file.
+*/
+type Properties = common.Properties
+
+/*
+Property is the key and value of the archive metadata.
+*/
+type Property = common.Property
+
+/*
+ParseProperty will parse the key=value string into the metadata property.
+*/
+func ParseProperty(s string) (Property, error) {
+	return common.ParseProperty(s)
+}
+
+/*
+Info is the summary of the archive.
+*/
+type Info = unpacker.Info
+
+/*
+ReadInfo will read the summary of the archive, the JRE release properties and
+the metadata from the trailer and header, data segments are not decoded.
+*/
+func ReadInfo(inputFile string, options UnPackOptions) (*Info, error) {
+	return unpacker.ReadInfo(inputFile, options)
+}
+
+/*
+SignArchive will sign the archive by the embedded or detached signature.
+*/
+func SignArchive(filename string, key ed25519.PrivateKey, detached bool) error {
+	return packer.SignArchive(filename, key, detached)
+}
+
+/*
+VerifySignature will check the archive signature against the trusted keys of the options.
+*/
+func VerifySignature(inputFile string, options UnPackOptions) (ed25519.PublicKey, error) {
+	return unpacker.VerifySignature(inputFile, options)
+}
+
+/*
+GenerateKey will create new signing key pair.
+*/
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return common.GenerateKey()
+}
+
+/*
+WriteKey will write public or private key into the file.
+*/
+func WriteKey(filename string, key []byte) error {
+	return common.WriteKey(filename, key)
+}
+
+/*
+ReadPublicKey will read public key from the file.
+*/
+func ReadPublicKey(filename string) (ed25519.PublicKey, error) {
+	return common.ReadPublicKey(filename)
+}
+
+/*
+ReadPrivateKey will read private key from the file.
+*/
+func ReadPrivateKey(filename string) (ed25519.PrivateKey, error) {
+	return common.ReadPrivateKey(filename)
+}
@@ -0,0 +1,207 @@
+// Copyright (C) 2018  Alexander Malyshev
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package jrepack
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io"
+	"time"
+
+	"github.com/alexript/jrepack/internal/pkg/packer"
+	"github.com/alexript/jrepack/internal/pkg/unpacker"
+	"github.com/alexript/jrepack/ui"
+)
+
+/*
+Option is the option of PackTo and UnpackFrom. Options, which have no meaning
+for the operation, are ignored.
+*/
+type Option func(c *config)
+
+// config is the set of the options of the packing and unpacking
+type config struct {
+	pack   PackOptions
+	unpack UnPackOptions
+}
+
+func newConfig(options []Option) *config {
+	c := &config{}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+/*
+WithClassTransform will group java classes and split them into streams before
+compression.
+*/
+func WithClassTransform() Option {
+	return func(c *config) { c.pack.ClassTransform = true }
+}
+
+/*
+WithBranchFilter will apply branch converter to the native executables before
+compression.
+*/
+func WithBranchFilter() Option {
+	return func(c *config) { c.pack.BranchFilter = true }
+}
+
+/*
+WithDictionary will compress small files in the independent frames with the
+dictionary, trained on the files sample. Small files are compressed by LZMA,
+when the frames are not smaller.
+*/
+func WithDictionary() Option {
+	return func(c *config) { c.pack.Dictionary = true }
+}
+
+/*
+WithAutoCodec will try several codecs for every data segment and keep the
+smallest result. Zero budget is DefaultAutoBudget.
+*/
+func WithAutoCodec(budget time.Duration) Option {
+	return func(c *config) {
+		c.pack.Auto = true
+		c.pack.AutoBudget = budget
+	}
+}
+
+/*
+WithSigningKey will sign the archive by the embedded signature.
+*/
+func WithSigningKey(key ed25519.PrivateKey) Option {
+	return func(c *config) { c.pack.SigningKey = key }
+}
+
+/*
+WithMetadata will store the key and value in the archive header.
+*/
+func WithMetadata(key, value string) Option {
+	return func(c *config) {
+		c.pack.Metadata = append(c.pack.Metadata, Property{Key: key, Value: value})
+	}
+}
+
+/*
+WithPassword will encrypt the packed archive or decrypt the unpacked one.
+*/
+func WithPassword(password string) Option {
+	return func(c *config) {
+		c.pack.Password = password
+		c.unpack.Password = password
+	}
+}
+
+/*
+WithLimits will check the unpacked archive against the limits.
+*/
+func WithLimits(limits Limits) Option {
+	return func(c *config) { c.unpack.Limits = limits }
+}
+
+/*
+WithPublicKeys will check the signature of the unpacked archive against the
+trusted keys.
+*/
+func WithPublicKeys(keys ...ed25519.PublicKey) Option {
+	return func(c *config) {
+		c.unpack.PublicKeys = append(c.unpack.PublicKeys, keys...)
+	}
+}
+
+/*
+WithRequiredSignature will refuse the unsigned archives.
+*/
+func WithRequiredSignature() Option {
+	return func(c *config) { c.unpack.RequireSignature = true }
+}
+
+/*
+WithSignatureFile will read the detached signature of the unpacked archive
+from the file.
+*/
+func WithSignatureFile(filename string) Option {
+	return func(c *config) { c.unpack.SignatureFile = filename }
+}
+
+/*
+WithLenient will write files with the wrong hash summ and report them after
+unpacking, instead of the unpacking failure. Damaged archive with the checked
+signature is refused anyway.
+*/
+func WithLenient() Option {
+	return func(c *config) { c.unpack.Lenient = true }
+}
+
+/*
+WithSelector will unpack only the selected entries.
+*/
+func WithSelector(selector *Selector) Option {
+	return func(c *config) { c.unpack.Select = selector }
+}
+
+/*
+WithUnwrap will write entries of the containers as the files of the folder
+with the container name, instead of the rebuilt container.
+*/
+func WithUnwrap() Option {
+	return func(c *config) { c.unpack.Unwrap = true }
+}
+
+/*
+WithUI will report the progress of the operation into the UI. Operations,
+running at the same time, should have their own UI.
+*/
+func WithUI(progress ui.JrepackUI) Option {
+	return func(c *config) {
+		c.pack.UI = progress
+		c.unpack.UI = progress
+	}
+}
+
+/*
+Sink is the destination of the unpacked files.
+*/
+type Sink = unpacker.Sink
+
+/*
+DirSink will write the unpacked files into the folder.
+*/
+func DirSink(folder string) Sink {
+	return unpacker.DirSink(folder)
+}
+
+/*
+PackTo will pack the folder into the archive, written into w. The writer is
+never read or rewound, so it may be the network connection or the pipe.
+*/
+func PackTo(ctx context.Context, inputFolder string, w io.Writer, options ...Option) error {
+	return packer.PackTo(ctx, inputFolder, w, newConfig(options).pack)
+}
+
+/*
+UnpackFrom will unpack the archive of the given size into the sink.
+*/
+func UnpackFrom(ctx context.Context, r io.ReaderAt, size int64, sink Sink, options ...Option) error {
+	return unpacker.UnpackFrom(ctx, r, size, sink, newConfig(options).unpack)
+}
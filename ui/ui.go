@@ -24,6 +24,7 @@ package ui
 
 import (
 	"fmt"
+	"sync"
 )
 
 // UI interface definition ----------------------------------------
@@ -52,7 +53,9 @@ type Compressed struct {
 	Total uint32
 }
 
-// JrepackUI is the main UI interface
+// JrepackUI is the main UI interface. Every packing or unpacking reports into
+// the UI of its own options, so one UI should not be shared by the operations,
+// running at the same time, unless it is safe for concurrent use.
 type JrepackUI interface {
 	Error(message string) // Display some error
 	Fatal(message string) // Display fatal error
@@ -101,18 +104,38 @@ func (ui defaultUI) Unpack(readedFolders, foldersNum int) {
 
 }
 
+// Default UI implementation. It keeps no state, so it is shared by the
+// concurrent operations.
+func Default() JrepackUI {
+	return defaultUI{}
+}
+
 // UI implementation setter and getter ----------------------------
 
 var (
-	someUI JrepackUI = defaultUI{}
+	currentLock sync.RWMutex
+	someUI      JrepackUI = defaultUI{}
 )
 
-// Set the current UI implementation
+// Set the current UI implementation, it is used when the operation options
+// have no UI. Nil restores the default UI.
+//
+// Deprecated: set UI of the operation options, the current UI is shared by
+// all operations without their own UI.
 func Set(ui JrepackUI) {
+	if ui == nil {
+		ui = defaultUI{}
+	}
+	currentLock.Lock()
 	someUI = ui
+	currentLock.Unlock()
 }
 
-// Current UI implementation
+// Current UI implementation, it is the default UI, unless other UI is set.
+//
+// Deprecated: set UI of the operation options.
 func Current() JrepackUI {
+	currentLock.RLock()
+	defer currentLock.RUnlock()
 	return someUI
 }